@@ -0,0 +1,224 @@
+package apiutil
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrBulkheadFull    = errors.New("bulkhead queue is full")
+	ErrBulkheadTimeout = errors.New("bulkhead wait timed out")
+)
+
+var bulkheads sync.Map // 名称 -> *Bulkhead
+
+// Bulkhead 加权信号量，限制同时处理的请求数量，超出的请求在有界队列中按先后顺序等待
+type Bulkhead struct {
+	name     string
+	limit    int64
+	maxQueue int
+	timeout  time.Duration
+
+	mu      sync.Mutex
+	inUse   int64
+	waiters list.List // *bulkheadWaiter
+
+	admitted      int64
+	rejected      int64
+	timedOut      int64
+	maxQueueDepth int
+}
+
+type bulkheadWaiter struct {
+	weight int64
+	ready  chan struct{}
+}
+
+// BulkheadStat 并发隔离的运行指标
+type BulkheadStat struct {
+	Name          string `json:"name"`
+	Limit         int64  `json:"limit"`
+	InUse         int64  `json:"inUse"`
+	QueueDepth    int    `json:"queueDepth"`
+	MaxQueue      int    `json:"maxQueue"`
+	MaxQueueDepth int    `json:"maxQueueDepth"` // 队列深度的历史峰值
+	Admitted      int64  `json:"admitted"`
+	Rejected      int64  `json:"rejected"` // 因队列已满被拒绝的次数
+	TimedOut      int64  `json:"timedOut"` // 因等待超时被拒绝的次数
+}
+
+// NewBulkhead 创建并登记并发隔离，limit 为总权重上限，maxQueue 为等待队列长度，timeout 为最长等待时间
+func NewBulkhead(name string, limit int64, maxQueue int, timeout time.Duration) *Bulkhead {
+	b := &Bulkhead{
+		name:     name,
+		limit:    limit,
+		maxQueue: maxQueue,
+		timeout:  timeout,
+	}
+	bulkheads.Store(name, b)
+	return b
+}
+
+// Acquire 获取 weight 份额度，队列已满时立即返回 ErrBulkheadFull，等待超时返回 ErrBulkheadTimeout
+func (b *Bulkhead) Acquire(ctx context.Context, weight int64) error {
+	b.mu.Lock()
+	if weight > b.limit {
+		b.rejected++
+		b.mu.Unlock()
+		return ErrBulkheadFull
+	}
+	if b.inUse+weight <= b.limit && b.waiters.Len() == 0 {
+		b.inUse += weight
+		b.admitted++
+		b.mu.Unlock()
+		return nil
+	}
+	if b.waiters.Len() >= b.maxQueue {
+		b.rejected++
+		b.mu.Unlock()
+		return ErrBulkheadFull
+	}
+
+	w := &bulkheadWaiter{weight: weight, ready: make(chan struct{})}
+	elem := b.waiters.PushBack(w)
+	if b.waiters.Len() > b.maxQueueDepth {
+		b.maxQueueDepth = b.waiters.Len()
+	}
+	b.mu.Unlock()
+
+	timer := time.NewTimer(b.timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-w.ready:
+		return nil
+	case <-timer.C:
+		err = ErrBulkheadTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-w.ready:
+		// 超时的同时已获得额度，按成功处理
+		return nil
+	default:
+	}
+	isFront := b.waiters.Front() == elem
+	b.waiters.Remove(elem)
+	if errors.Is(err, ErrBulkheadTimeout) {
+		b.timedOut++
+	}
+	// 队首离开后，后面较小权重的请求可能已经可以执行
+	if isFront && b.inUse < b.limit {
+		b.notifyWaitersLocked()
+	}
+	return err
+}
+
+// Release 归还 weight 份额度
+func (b *Bulkhead) Release(weight int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.inUse -= weight
+	if b.inUse < 0 {
+		panic("apiutil: bulkhead released more than held")
+	}
+	b.notifyWaitersLocked()
+}
+
+// notifyWaitersLocked 按先后顺序唤醒等待者，队首额度不足时不越过它，避免大权重请求饿死
+func (b *Bulkhead) notifyWaitersLocked() {
+	for {
+		next := b.waiters.Front()
+		if next == nil {
+			return
+		}
+		w := next.Value.(*bulkheadWaiter)
+		if b.inUse+w.weight > b.limit {
+			return
+		}
+		b.inUse += w.weight
+		b.admitted++
+		b.waiters.Remove(next)
+		close(w.ready)
+	}
+}
+
+// Stat 获取运行指标
+func (b *Bulkhead) Stat() BulkheadStat {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BulkheadStat{
+		Name:          b.name,
+		Limit:         b.limit,
+		InUse:         b.inUse,
+		QueueDepth:    b.waiters.Len(),
+		MaxQueue:      b.maxQueue,
+		MaxQueueDepth: b.maxQueueDepth,
+		Admitted:      b.admitted,
+		Rejected:      b.rejected,
+		TimedOut:      b.timedOut,
+	}
+}
+
+// Middleware 并发隔离中间件，每个请求占用 weight 份额度；队列已满返回 429，等待超时返回 503
+func (b *Bulkhead) Middleware(weight int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		err := b.Acquire(c.Request.Context(), weight)
+		if err != nil {
+			status, code := http.StatusServiceUnavailable, 5030
+			if errors.Is(err, ErrBulkheadFull) {
+				status, code = http.StatusTooManyRequests, 4290
+			}
+			c.AbortWithStatusJSON(status, Response{
+				Code:    code,
+				Message: err.Error(),
+				Data:    EmptyResponse{},
+			})
+			return
+		}
+		defer b.Release(weight)
+
+		c.Next()
+	}
+}
+
+// UseBulkhead 为单个路由创建并发隔离中间件，以路由名称登记指标
+//
+//	r.POST("/export", apiutil.UseBulkhead("export", 4, 16, 5*time.Second), handler)
+func UseBulkhead(name string, limit int64, maxQueue int, timeout time.Duration) gin.HandlerFunc {
+	return NewBulkhead(name, limit, maxQueue, timeout).Middleware(1)
+}
+
+// BulkheadStats 获取全部并发隔离的运行指标
+func BulkheadStats() []BulkheadStat {
+	var stats []BulkheadStat
+	bulkheads.Range(func(_, value interface{}) bool {
+		stats = append(stats, value.(*Bulkhead).Stat())
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+func GetBulkheadStatsFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, Response{
+		Code:    2000,
+		Message: "",
+		Data:    BulkheadStats(),
+	})
+}
@@ -0,0 +1,133 @@
+package apiutil
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// waitFor 轮询直到 cond 成立，超时则测试失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBulkheadMiddleware(t *testing.T) {
+	b := NewBulkhead("test-middleware", 1, 1, 50*time.Millisecond)
+	release := make(chan struct{})
+	r := gin.New()
+	r.GET("/work", b.Middleware(1), func(c *gin.Context) {
+		if c.Query("block") != "" {
+			<-release
+		}
+		c.JSON(http.StatusOK, Response{Code: 2000, Message: "", Data: EmptyResponse{}})
+	})
+	do := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/work"+query, nil))
+		return w
+	}
+
+	holder := make(chan *httptest.ResponseRecorder)
+	go func() { holder <- do("?block=1") }()
+	waitFor(t, func() bool { return b.Stat().InUse == 1 })
+
+	queued := make(chan *httptest.ResponseRecorder)
+	go func() { queued <- do("") }()
+	waitFor(t, func() bool { return b.Stat().QueueDepth == 1 })
+
+	if w := do(""); w.Code != http.StatusTooManyRequests || responseCode(t, w) != 4290 {
+		t.Errorf("queue full: status = %d, body = %s", w.Code, w.Body.String())
+	}
+	if w := <-queued; w.Code != http.StatusServiceUnavailable || responseCode(t, w) != 5030 {
+		t.Errorf("queue timeout: status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	close(release)
+	if w := <-holder; w.Code != http.StatusOK {
+		t.Errorf("holder: status = %d", w.Code)
+	}
+	if w := do(""); w.Code != http.StatusOK {
+		t.Errorf("after release: status = %d", w.Code)
+	}
+
+	stat := b.Stat()
+	if stat.InUse != 0 || stat.QueueDepth != 0 || stat.Admitted != 2 || stat.Rejected != 1 || stat.TimedOut != 1 || stat.MaxQueueDepth != 1 {
+		t.Errorf("stat = %+v", stat)
+	}
+}
+
+func TestBulkheadFIFO(t *testing.T) {
+	b := NewBulkhead("test-fifo", 2, 4, time.Second)
+	ctx := context.Background()
+	if err := b.Acquire(ctx, 1); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+	if err := b.Acquire(ctx, 3); !errors.Is(err, ErrBulkheadFull) {
+		t.Errorf("weight over limit: err = %v, want ErrBulkheadFull", err)
+	}
+
+	order := make(chan int64, 2)
+	acquire := func(weight int64) {
+		if err := b.Acquire(ctx, weight); err != nil {
+			t.Errorf("Acquire(%d): %v", weight, err)
+			return
+		}
+		order <- weight
+	}
+	go acquire(2)
+	waitFor(t, func() bool { return b.Stat().QueueDepth == 1 })
+	// 额度足够的小权重请求也不能越过队首的大权重请求
+	go acquire(1)
+	waitFor(t, func() bool { return b.Stat().QueueDepth == 2 })
+
+	b.Release(1)
+	if first := <-order; first != 2 {
+		t.Fatalf("first admitted weight = %d, want 2", first)
+	}
+	b.Release(2)
+	if second := <-order; second != 1 {
+		t.Fatalf("second admitted weight = %d, want 1", second)
+	}
+	b.Release(1)
+}
+
+func TestBulkheadCanceledWaiterUnblocksQueue(t *testing.T) {
+	b := NewBulkhead("test-cancel", 2, 4, time.Second)
+	if err := b.Acquire(context.Background(), 1); err != nil {
+		t.Fatalf("Acquire: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	heavy := make(chan error)
+	go func() { heavy <- b.Acquire(ctx, 2) }()
+	waitFor(t, func() bool { return b.Stat().QueueDepth == 1 })
+
+	light := make(chan error)
+	go func() { light <- b.Acquire(context.Background(), 1) }()
+	waitFor(t, func() bool { return b.Stat().QueueDepth == 2 })
+
+	// 队首取消后，后面可以执行的请求应立即获得额度
+	cancel()
+	if err := <-heavy; !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled waiter: err = %v", err)
+	}
+	select {
+	case err := <-light:
+		if err != nil {
+			t.Errorf("light waiter: %v", err)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("light waiter still blocked after the queue head left")
+	}
+}
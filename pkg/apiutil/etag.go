@@ -0,0 +1,167 @@
+package apiutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ComputeETag 计算返回体序列化结果的强 ETag
+func ComputeETag(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return etagOf(data), nil
+}
+
+func etagOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// JSONWithETag 以 ETag 返回标准返回体，ETag 由序列化结果计算；
+// 若请求的 If-None-Match 或 If-Modified-Since 命中则返回 304，lastModified 为零值时不参与判断
+func JSONWithETag(c *gin.Context, lastModified time.Time, resp Response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		panic(err)
+	}
+	writeConditional(c, etagOf(data), lastModified, data)
+}
+
+// JSONWithCustomETag 以处理器给定的 ETag 返回标准返回体，适合版本号、修订号等无需序列化即可得到的标识
+func JSONWithCustomETag(c *gin.Context, etag string, lastModified time.Time, resp Response) {
+	etag = quoteETag(etag)
+	if notModified(c, etag, lastModified) {
+		writeNotModified(c, etag, lastModified)
+		return
+	}
+
+	data, err := json.Marshal(resp)
+	if err != nil {
+		panic(err)
+	}
+	setValidators(c, etag, lastModified)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+func writeConditional(c *gin.Context, etag string, lastModified time.Time, data []byte) {
+	if notModified(c, etag, lastModified) {
+		writeNotModified(c, etag, lastModified)
+		return
+	}
+	setValidators(c, etag, lastModified)
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+func writeNotModified(c *gin.Context, etag string, lastModified time.Time) {
+	setValidators(c, etag, lastModified)
+	c.Status(http.StatusNotModified)
+	c.Writer.WriteHeaderNow()
+	c.Abort()
+}
+
+func setValidators(c *gin.Context, etag string, lastModified time.Time) {
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// notModified 按 RFC 9110 判断：存在 If-None-Match 时忽略 If-Modified-Since
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := c.GetHeader("If-None-Match"); inm != "" {
+		return matchETag(inm, etag, true)
+	}
+
+	if ims := c.GetHeader("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		t, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// HTTP 日期只精确到秒
+		return !lastModified.Truncate(time.Second).After(t)
+	}
+	return false
+}
+
+// CheckIfMatch 校验写请求的 If-Match 头，实现乐观并发控制；
+// 不匹配时返回 412 并返回 false，调用方直接 return 即可。未携带 If-Match 时放行。
+// 校验与写入之间必须持有同一把锁，否则两个并发写请求可能都通过校验，不便自行加锁时使用 UpdateIfMatch
+func CheckIfMatch(c *gin.Context, currentETag string) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || matchETag(ifMatch, quoteETag(currentETag), false) {
+		return true
+	}
+
+	c.Header("ETag", quoteETag(currentETag))
+	c.AbortWithStatusJSON(http.StatusPreconditionFailed, Response{
+		Code:    4120,
+		Message: "Resource has been modified",
+		Data:    EmptyResponse{},
+	})
+	return false
+}
+
+// RequireIfMatch 与 CheckIfMatch 相同，但未携带 If-Match 时返回 428
+func RequireIfMatch(c *gin.Context, currentETag string) bool {
+	if c.GetHeader("If-Match") == "" {
+		c.AbortWithStatusJSON(http.StatusPreconditionRequired, Response{
+			Code:    4280,
+			Message: "If-Match header is required",
+			Data:    EmptyResponse{},
+		})
+		return false
+	}
+	return CheckIfMatch(c, currentETag)
+}
+
+// UpdateIfMatch 在持有 locker 期间读取当前 ETag、校验 If-Match 并执行 update，校验与写入之间不会插入其他写请求；
+// 不匹配时返回 412 且不执行 update，返回 false
+func UpdateIfMatch(c *gin.Context, locker sync.Locker, currentETag func() string, update func()) bool {
+	locker.Lock()
+	defer locker.Unlock()
+	if !CheckIfMatch(c, currentETag()) {
+		return false
+	}
+	update()
+	return true
+}
+
+// matchETag 判断头部中的 ETag 列表是否包含 etag，weak 为 true 时使用弱比较
+func matchETag(header string, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		// 强比较时弱 ETag 永不匹配
+		if !strings.HasPrefix(candidate, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
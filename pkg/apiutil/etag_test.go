@@ -0,0 +1,155 @@
+package apiutil
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func serveETag(handler gin.HandlerFunc, method string, headers map[string]string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(method, "/item", handler)
+	req := httptest.NewRequest(method, "/item", nil)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func responseCode(t *testing.T, w *httptest.ResponseRecorder) int {
+	t.Helper()
+	var resp Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("parse response %q: %v", w.Body.String(), err)
+	}
+	return resp.Code
+}
+
+func TestJSONWithETag(t *testing.T) {
+	modified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	handler := func(c *gin.Context) {
+		JSONWithETag(c, modified, Response{Code: 2000, Message: "", Data: "v1"})
+	}
+
+	w := serveETag(handler, http.MethodGet, nil)
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" || w.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+		t.Fatalf("status = %d, headers = %v", w.Code, w.Header())
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"matching If-None-Match", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"weak If-None-Match", map[string]string{"If-None-Match": "W/" + etag}, http.StatusNotModified},
+		{"list If-None-Match", map[string]string{"If-None-Match": `"other", ` + etag}, http.StatusNotModified},
+		{"stale If-None-Match", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"If-None-Match wins over If-Modified-Since", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusOK},
+		{"If-Modified-Since not modified", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, http.StatusNotModified},
+		{"If-Modified-Since modified", map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveETag(handler, http.MethodGet, tt.headers)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if w.Code == http.StatusNotModified && w.Body.Len() != 0 {
+				t.Errorf("304 has a body: %q", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	handler := func(c *gin.Context) {
+		if !CheckIfMatch(c, "v2") {
+			return
+		}
+		c.JSON(http.StatusOK, Response{Code: 2000, Message: "", Data: EmptyResponse{}})
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		code    int
+	}{
+		{"absent", nil, http.StatusOK, 2000},
+		{"match", map[string]string{"If-Match": `"v2"`}, http.StatusOK, 2000},
+		{"wildcard", map[string]string{"If-Match": "*"}, http.StatusOK, 2000},
+		{"stale", map[string]string{"If-Match": `"v1"`}, http.StatusPreconditionFailed, 4120},
+		{"weak never matches", map[string]string{"If-Match": `W/"v2"`}, http.StatusPreconditionFailed, 4120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveETag(handler, http.MethodPut, tt.headers)
+			if w.Code != tt.status || responseCode(t, w) != tt.code {
+				t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireIfMatch(t *testing.T) {
+	handler := func(c *gin.Context) {
+		if !RequireIfMatch(c, "v2") {
+			return
+		}
+		c.JSON(http.StatusOK, Response{Code: 2000, Message: "", Data: EmptyResponse{}})
+	}
+	if w := serveETag(handler, http.MethodPut, nil); w.Code != http.StatusPreconditionRequired || responseCode(t, w) != 4280 {
+		t.Errorf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUpdateIfMatchIsAtomic(t *testing.T) {
+	var mu sync.Mutex
+	version := 1
+	handler := func(c *gin.Context) {
+		ok := UpdateIfMatch(c, &mu, func() string { return strconv.Itoa(version) }, func() {
+			// 放大校验与写入之间的窗口
+			time.Sleep(10 * time.Millisecond)
+			version++
+		})
+		if ok {
+			c.JSON(http.StatusOK, Response{Code: 2000, Message: "", Data: EmptyResponse{}})
+		}
+	}
+
+	const writers = 8
+	statuses := make(chan int, writers)
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- serveETag(handler, http.MethodPut, map[string]string{"If-Match": `"1"`}).Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	succeeded := 0
+	for status := range statuses {
+		if status == http.StatusOK {
+			succeeded++
+		}
+	}
+	if succeeded != 1 || version != 2 {
+		t.Errorf("succeeded = %d, version = %d, want 1 and 2", succeeded, version)
+	}
+}
@@ -0,0 +1,178 @@
+package apiutil
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HeaderAPIVersion 按请求头选择接口版本时使用的头部
+const HeaderAPIVersion = "X-API-Version"
+
+const (
+	deprecatedPeerTTL      = 24 * time.Hour // 同一调用方再次写入日志的间隔
+	deprecatedPeerCapacity = 4096           // 记录的调用方数量上限
+)
+
+// Deprecation 接口弃用信息
+type Deprecation struct {
+	Since     time.Time // 开始弃用的时间，零值表示仅标记为已弃用
+	Sunset    time.Time // 计划下线的时间，零值表示未定
+	Successor string    // 替代接口的地址，如 /v2/config
+}
+
+var (
+	deprecatedCalls  sync.Map // 路由 -> *int64
+	deprecatedRoutes sync.Map // 路由 -> Deprecation
+
+	peersMu         sync.Mutex
+	deprecatedPeers = make(map[string]time.Time) // 路由+调用方 -> 上次写入日志的时间
+)
+
+// VersionGroup 创建以版本号为路径前缀的路由组，如 VersionGroup(r, "v1") 对应 /v1
+func VersionGroup(r gin.IRouter, version string, handlers ...gin.HandlerFunc) *gin.RouterGroup {
+	return r.Group("/"+strings.Trim(version, "/"), handlers...)
+}
+
+// DeprecatedVersionGroup 创建已弃用的版本路由组，组内全部接口都会附带弃用信息
+func DeprecatedVersionGroup(r gin.IRouter, version string, d Deprecation, handlers ...gin.HandlerFunc) *gin.RouterGroup {
+	return VersionGroup(r, version, append([]gin.HandlerFunc{Deprecate(d)}, handlers...)...)
+}
+
+// Deprecate 弃用中间件，为响应添加 Deprecation、Sunset 和 Link 头部，并记录和统计调用
+func Deprecate(d Deprecation) gin.HandlerFunc {
+	deprecationValue := "true"
+	if !d.Since.IsZero() {
+		deprecationValue = "@" + strconv.FormatInt(d.Since.Unix(), 10)
+	}
+
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		deprecatedRoutes.LoadOrStore(route, d)
+
+		c.Header("Deprecation", deprecationValue)
+		if !d.Sunset.IsZero() {
+			c.Header("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+		if len(d.Successor) > 0 {
+			c.Header("Link", "<"+d.Successor+`>; rel="successor-version"`)
+		}
+
+		counter, _ := deprecatedCalls.LoadOrStore(route, new(int64))
+		atomic.AddInt64(counter.(*int64), 1)
+
+		// 每个调用方每天只记录一次，避免日志被高频调用刷屏
+		if firstCallOf(route + " " + c.ClientIP()) {
+			logutil.Printf("[Deprecate] 调用了已弃用的接口 %s，调用方：%s，User-Agent：%s", route, c.ClientIP(), c.Request.UserAgent())
+		}
+
+		c.Next()
+	}
+}
+
+// firstCallOf 判断调用方是否需要写入日志；记录已满时先清理过期的调用方，仍然已满则全部清空
+func firstCallOf(peer string) bool {
+	now := time.Now()
+	peersMu.Lock()
+	defer peersMu.Unlock()
+
+	if last, ok := deprecatedPeers[peer]; ok && now.Sub(last) < deprecatedPeerTTL {
+		return false
+	}
+	if len(deprecatedPeers) >= deprecatedPeerCapacity {
+		for k, last := range deprecatedPeers {
+			if now.Sub(last) >= deprecatedPeerTTL {
+				delete(deprecatedPeers, k)
+			}
+		}
+		if len(deprecatedPeers) >= deprecatedPeerCapacity {
+			deprecatedPeers = make(map[string]time.Time)
+		}
+	}
+	deprecatedPeers[peer] = now
+	return true
+}
+
+// DeprecatedCall 已弃用接口的调用统计
+type DeprecatedCall struct {
+	Route  string `json:"route"`
+	Calls  int64  `json:"calls"`
+	Sunset string `json:"sunset,omitempty"`
+}
+
+// DeprecatedCalls 获取已弃用接口的调用统计，用于判断旧版本何时可以下线
+func DeprecatedCalls() []DeprecatedCall {
+	var calls []DeprecatedCall
+	deprecatedCalls.Range(func(key, value interface{}) bool {
+		call := DeprecatedCall{
+			Route: key.(string),
+			Calls: atomic.LoadInt64(value.(*int64)),
+		}
+		if d, ok := deprecatedRoutes.Load(key); ok && !d.(Deprecation).Sunset.IsZero() {
+			call.Sunset = d.(Deprecation).Sunset.UTC().Format(http.TimeFormat)
+		}
+		calls = append(calls, call)
+		return true
+	})
+	return calls
+}
+
+func GetDeprecatedCallsFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, Response{
+		Code:    2000,
+		Message: "",
+		Data:    DeprecatedCalls(),
+	})
+}
+
+// VersionRouter 包装 gin 引擎，使未带版本前缀、且属于 prefixes 中某个接口前缀的请求按 X-API-Version 头部选择版本，
+// 头部缺失时使用 defaultVersion，defaultVersion 为空时保持原路径；versions 为全部已注册的版本。
+// 健康检查、静态文件等其他路径不做改写
+//
+//	http.ListenAndServe(":8080", apiutil.VersionRouter(r, "v1", []string{"/config", "/users"}, "v1", "v2"))
+func VersionRouter(engine http.Handler, defaultVersion string, prefixes []string, versions ...string) http.Handler {
+	known := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		known[strings.Trim(v, "/")] = true
+	}
+	apiPrefixes := make([]string, 0, len(prefixes))
+	for _, p := range prefixes {
+		if p = strings.Trim(p, "/"); len(p) > 0 {
+			apiPrefixes = append(apiPrefixes, "/"+p)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		first := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+		if !known[first] && hasPathPrefix(r.URL.Path, apiPrefixes) {
+			version := strings.Trim(r.Header.Get(HeaderAPIVersion), "/ ")
+			if !known[version] {
+				version = defaultVersion
+			}
+			if len(version) == 0 {
+				engine.ServeHTTP(w, r)
+				return
+			}
+			r.URL.Path = "/" + version + r.URL.Path
+			if len(r.URL.RawPath) > 0 {
+				r.URL.RawPath = "/" + version + r.URL.RawPath
+			}
+		}
+		engine.ServeHTTP(w, r)
+	})
+}
+
+// hasPathPrefix 按路径段匹配前缀，/config 匹配 /config 和 /config/a，不匹配 /configs
+func hasPathPrefix(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
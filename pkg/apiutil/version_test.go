@@ -0,0 +1,113 @@
+package apiutil
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newVersionedEngine() *gin.Engine {
+	r := gin.New()
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	v1 := DeprecatedVersionGroup(r, "v1", Deprecation{
+		Since:     time.Unix(1700000000, 0),
+		Sunset:    sunset,
+		Successor: "/v2/config",
+	})
+	v1.GET("/config", func(c *gin.Context) { c.String(http.StatusOK, "v1") })
+	v2 := VersionGroup(r, "/v2/")
+	v2.GET("/config", func(c *gin.Context) { c.String(http.StatusOK, "v2") })
+	r.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	return r
+}
+
+func TestVersionRouter(t *testing.T) {
+	handler := VersionRouter(newVersionedEngine(), "v1", []string{"/config"}, "v1", "v2")
+
+	tests := []struct {
+		name    string
+		path    string
+		version string
+		status  int
+		body    string
+	}{
+		{"default version", "/config", "", http.StatusOK, "v1"},
+		{"header version", "/config", "v2", http.StatusOK, "v2"},
+		{"unknown header falls back", "/config", "v9", http.StatusOK, "v1"},
+		{"explicit prefix wins", "/v2/config", "v1", http.StatusOK, "v2"},
+		{"unregistered prefix untouched", "/health", "v2", http.StatusOK, "ok"},
+		{"prefix matches whole segment", "/configs", "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if len(tt.version) > 0 {
+				req.Header.Set(HeaderAPIVersion, tt.version)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			if w.Code != tt.status || (len(tt.body) > 0 && w.Body.String() != tt.body) {
+				t.Errorf("status = %d, body = %q", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeprecateHeadersAndCalls(t *testing.T) {
+	r := newVersionedEngine()
+	callsOf := func(route string) int64 {
+		for _, call := range DeprecatedCalls() {
+			if call.Route == route {
+				return call.Calls
+			}
+		}
+		return 0
+	}
+	before := callsOf("GET /v1/config")
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/config", nil))
+		if i > 0 {
+			continue
+		}
+		if got := w.Header().Get("Deprecation"); got != "@1700000000" {
+			t.Errorf("Deprecation = %q", got)
+		}
+		if got := w.Header().Get("Sunset"); got != "Fri, 01 Jan 2027 00:00:00 GMT" {
+			t.Errorf("Sunset = %q", got)
+		}
+		if got := w.Header().Get("Link"); got != `</v2/config>; rel="successor-version"` {
+			t.Errorf("Link = %q", got)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/config", nil))
+	if got := w.Header().Get("Deprecation"); got != "" {
+		t.Errorf("current version has Deprecation = %q", got)
+	}
+	if got := callsOf("GET /v1/config") - before; got != 3 {
+		t.Errorf("calls = %d, want 3", got)
+	}
+}
+
+func TestFirstCallOf(t *testing.T) {
+	peer := "GET /v1/first 192.0.2.1"
+	if !firstCallOf(peer) {
+		t.Fatal("first call not logged")
+	}
+	if firstCallOf(peer) {
+		t.Error("repeated call logged again")
+	}
+
+	// 过期后再次记录
+	peersMu.Lock()
+	deprecatedPeers[peer] = time.Now().Add(-deprecatedPeerTTL)
+	peersMu.Unlock()
+	if !firstCallOf(peer) {
+		t.Error("call after ttl not logged")
+	}
+}
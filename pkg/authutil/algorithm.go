@@ -0,0 +1,249 @@
+package authutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"math/big"
+)
+
+// 密钥封装算法，用于加密可信访问请求头和 EncryptedData 中的 AES 密钥
+const (
+	AlgRSA1_5     = "RSA1_5"       // RSA PKCS#1 v1.5，旧版本服务使用
+	AlgRSAOAEP256 = "RSA-OAEP-256" // RSA-OAEP，使用 SHA-256
+)
+
+// 签名算法，命名与 JWA 保持一致
+const (
+	AlgRS256 = "RS256" // RSA PKCS#1 v1.5 + SHA-256
+	AlgPS256 = "PS256" // RSA-PSS + SHA-256
+	AlgES256 = "ES256" // ECDSA P-256 + SHA-256
+	AlgEdDSA = "EdDSA" // Ed25519
+)
+
+var (
+	errUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	errUnsupportedKey       = errors.New("unsupported key type")
+	errNotRSAKey            = errors.New("key wrapping requires an RSA key")
+	errLegacyKeyWrap        = errors.New("RSA1_5 key wrapping is not allowed")
+)
+
+/*****************************************************************
+*							密钥封装
+*****************************************************************/
+
+func wrapKey(alg string, publicKey *rsa.PublicKey, input []byte) ([]byte, error) {
+	switch alg {
+	case AlgRSAOAEP256:
+		return rsa.EncryptOAEP(sha256.New(), rand.Reader, publicKey, input, nil)
+	case AlgRSA1_5:
+		return rsa.EncryptPKCS1v15(rand.Reader, publicKey, input)
+	default:
+		return nil, errUnsupportedAlgorithm
+	}
+}
+
+// unwrapKey 解密封装的密钥，alg 为空时按旧版本的 RSA1_5 处理
+func unwrapKey(alg string, privateKey *rsa.PrivateKey, input []byte) ([]byte, error) {
+	switch alg {
+	case AlgRSAOAEP256:
+		return rsa.DecryptOAEP(sha256.New(), rand.Reader, privateKey, input, nil)
+	case AlgRSA1_5, "":
+		return rsa.DecryptPKCS1v15(rand.Reader, privateKey, input)
+	default:
+		return nil, errUnsupportedAlgorithm
+	}
+}
+
+/*****************************************************************
+*							签名
+*****************************************************************/
+
+// defaultSignatureAlgorithm 按密钥类型选择签名算法，RSA 密钥使用 PSS
+func defaultSignatureAlgorithm(key crypto.PublicKey) (string, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return AlgPS256, nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() {
+			return "", errUnsupportedKey
+		}
+		return AlgES256, nil
+	case ed25519.PublicKey:
+		return AlgEdDSA, nil
+	default:
+		return "", errUnsupportedKey
+	}
+}
+
+// signMessage 按算法签名，ES256 的签名为 JWS 使用的 r||s 定长格式
+func signMessage(alg string, signer crypto.Signer, message []byte) ([]byte, error) {
+	hashed := sha256.Sum256(message)
+
+	switch alg {
+	case AlgRS256:
+		key, ok := signer.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errUnsupportedKey
+		}
+		return rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	case AlgPS256:
+		key, ok := signer.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errUnsupportedKey
+		}
+		return rsa.SignPSS(rand.Reader, key, crypto.SHA256, hashed[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case AlgES256:
+		key, ok := signer.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, errUnsupportedKey
+		}
+		r, s, err := ecdsa.Sign(rand.Reader, key, hashed[:])
+		if err != nil {
+			return nil, err
+		}
+		signature := make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+		return signature, nil
+	case AlgEdDSA:
+		key, ok := signer.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errUnsupportedKey
+		}
+		return ed25519.Sign(key, message), nil
+	default:
+		return nil, errUnsupportedAlgorithm
+	}
+}
+
+func verifyMessage(alg string, publicKey crypto.PublicKey, message []byte, signature []byte) error {
+	hashed := sha256.Sum256(message)
+
+	switch alg {
+	case AlgRS256:
+		key, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return errUnsupportedKey
+		}
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, hashed[:], signature)
+	case AlgPS256:
+		key, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return errUnsupportedKey
+		}
+		return rsa.VerifyPSS(key, crypto.SHA256, hashed[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case AlgES256:
+		key, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return errUnsupportedKey
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(key, hashed[:], r, s) {
+			return errors.New("ecdsa: verification error")
+		}
+		return nil
+	case AlgEdDSA:
+		key, ok := publicKey.(ed25519.PublicKey)
+		if !ok {
+			return errUnsupportedKey
+		}
+		if !ed25519.Verify(key, message, signature) {
+			return errors.New("ed25519: verification error")
+		}
+		return nil
+	default:
+		return errUnsupportedAlgorithm
+	}
+}
+
+/*****************************************************************
+*							PEM 解析
+*****************************************************************/
+
+// parsePublicKeyPEM 解析 PKIX 或 PKCS#1 格式的公钥，支持 RSA、ECDSA P-256 和 Ed25519
+func parsePublicKeyPEM(pemStr string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, errors.New("failed to parse public key")
+	}
+
+	var parsedPublicKey interface{}
+	var err error
+	if block.Type == "RSA PUBLIC KEY" {
+		parsedPublicKey, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	} else {
+		parsedPublicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.New("failed to parse public key")
+	}
+
+	if _, err := defaultSignatureAlgorithm(parsedPublicKey); err != nil {
+		return nil, errors.New("not a supported public key")
+	}
+	return parsedPublicKey, nil
+}
+
+// parsePrivateKeyPEM 解析 PKCS#1、PKCS#8 或 SEC 1 格式的私钥，支持 RSA、ECDSA P-256 和 Ed25519
+func parsePrivateKeyPEM(pemStr string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, errors.New("failed to parse private key")
+	}
+
+	var parsedPrivateKey interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsedPrivateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsedPrivateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		parsedPrivateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, errors.New("failed to parse private key")
+	}
+
+	signer, ok := parsedPrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("not a supported private key")
+	}
+	if _, err := defaultSignatureAlgorithm(signer.Public()); err != nil {
+		return nil, errors.New("not a supported private key")
+	}
+	return signer, nil
+}
+
+func parseRSAPublicKeyPEM(pemStr string) (*rsa.PublicKey, error) {
+	publicKey, err := parsePublicKeyPEM(pemStr)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("not a valid RSA public key")
+	}
+	return rsaKey, nil
+}
+
+func parseRSAPrivateKeyPEM(pemStr string) (*rsa.PrivateKey, error) {
+	privateKey, err := parsePrivateKeyPEM(pemStr)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := privateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not a valid RSA private key")
+	}
+	return rsaKey, nil
+}
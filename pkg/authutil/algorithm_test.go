@@ -0,0 +1,178 @@
+package authutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alg    string
+		signer crypto.Signer
+	}{
+		{AlgRS256, rsaKey},
+		{AlgPS256, rsaKey},
+		{AlgES256, ecKey},
+		{AlgEdDSA, edKey},
+	}
+	message := []byte("GET\n/orders")
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			signature, err := signMessage(tt.alg, tt.signer, message)
+			if err != nil {
+				t.Fatalf("signMessage: %v", err)
+			}
+			if err := verifyMessage(tt.alg, tt.signer.Public(), message, signature); err != nil {
+				t.Errorf("verifyMessage: %v", err)
+			}
+			if err := verifyMessage(tt.alg, tt.signer.Public(), []byte("GET\n/refunds"), signature); err == nil {
+				t.Error("signature verified for another message")
+			}
+		})
+	}
+
+	// 算法与密钥类型不匹配时拒绝，防止以 RSA 公钥冒充其他算法
+	if _, err := signMessage(AlgES256, rsaKey, message); err == nil {
+		t.Error("ES256 signed with an RSA key")
+	}
+	signature, _ := signMessage(AlgPS256, rsaKey, message)
+	if err := verifyMessage(AlgRS256, &rsaKey.PublicKey, message, signature); err == nil {
+		t.Error("PS256 signature verified as RS256")
+	}
+	if _, err := signMessage("none", edKey, message); err == nil {
+		t.Error("unsupported algorithm accepted")
+	}
+}
+
+func TestWrapKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	for _, alg := range []string{AlgRSAOAEP256, AlgRSA1_5} {
+		wrapped, err := wrapKey(alg, &key.PublicKey, secret)
+		if err != nil {
+			t.Fatalf("wrapKey(%s): %v", alg, err)
+		}
+		unwrapped, err := unwrapKey(alg, key, wrapped)
+		if err != nil || !bytes.Equal(unwrapped, secret) {
+			t.Errorf("unwrapKey(%s) = %x, %v", alg, unwrapped, err)
+		}
+	}
+
+	// 不带算法标识的旧数据按 RSA1_5 处理
+	legacy, _ := wrapKey(AlgRSA1_5, &key.PublicKey, secret)
+	if unwrapped, err := unwrapKey("", key, legacy); err != nil || !bytes.Equal(unwrapped, secret) {
+		t.Errorf("legacy unwrap = %x, %v", unwrapped, err)
+	}
+	oaep, _ := wrapKey(AlgRSAOAEP256, &key.PublicKey, secret)
+	if _, err := unwrapKey(AlgRSA1_5, key, oaep); err == nil {
+		t.Error("OAEP ciphertext unwrapped as RSA1_5")
+	}
+}
+
+func TestParsePrivateKeyFormats(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8 := func(key interface{}) string {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		pem  string
+		ok   bool
+	}{
+		{"PKCS#1 RSA", string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})), true},
+		{"PKCS#8 RSA", pkcs8(rsaKey), true},
+		{"SEC 1 ECDSA", string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: sec1})), true},
+		{"PKCS#8 ECDSA", pkcs8(ecKey), true},
+		{"ECDSA P-384", pkcs8(p384Key), false},
+		{"not PEM", "private key", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parsePrivateKeyPEM(tt.pem); (err == nil) != tt.ok {
+				t.Errorf("err = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEncryptedDataAlgorithm(t *testing.T) {
+	private, _, err := GenerateRSAKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthenticator()
+	if _, err := a.AddKey(private, KeyStateActive); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alg := range []string{AlgRSAOAEP256, AlgRSA1_5} {
+		if err := a.SetKeyWrapAlgorithm(alg); err != nil {
+			t.Fatal(err)
+		}
+		a.SetAllowLegacyKeyWrap(true)
+		data, err := a.EncryptAESString("secret")
+		if err != nil {
+			t.Fatalf("EncryptAESString(%s): %v", alg, err)
+		}
+		if data.Alg != alg {
+			t.Errorf("Alg = %q, want %q", data.Alg, alg)
+		}
+		if plain, err := a.DecryptAESString(data); err != nil || plain != "secret" {
+			t.Errorf("DecryptAESString(%s) = %q, %v", alg, plain, err)
+		}
+
+		// 不允许旧封装算法时拒绝 RSA1_5
+		a.SetAllowLegacyKeyWrap(false)
+		if _, err := a.DecryptAESString(data); (err != nil) != (alg == AlgRSA1_5) {
+			t.Errorf("legacy disallowed, alg %s: err = %v", alg, err)
+		}
+	}
+	if err := a.SetKeyWrapAlgorithm("RSA-OAEP"); err == nil {
+		t.Error("unsupported key wrap algorithm accepted")
+	}
+}
@@ -0,0 +1,500 @@
+package authutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/datautil"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerAPIKey = "X-LincService-API-Key"
+
+	HeaderAPIKey = headerAPIKey // 外部客户端携带 API Key 的请求头，也可以使用 Authorization: ApiKey <key>
+
+	apiKeyPrefix = "lnk_"
+	apiKeyScheme = "ApiKey "
+
+	lastUsedFlushInterval = time.Minute // 后台写回最近使用时间的间隔
+)
+
+var (
+	invalidAPIKey    = errors.New("invalid api key")
+	unverifiedAPIKey = errors.New("api key cannot be verified")
+	expiredAPIKey    = errors.New("api key is expired")
+	revokedAPIKey    = errors.New("api key has been revoked")
+
+	ErrAPIKeyNotFound = errors.New("api key not found")
+)
+
+// APIKey 外部客户端的 API Key 元数据，密钥本身只在创建时返回一次，磁盘上只保存摘要
+type APIKey struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"` // 持有方名称，认证后作为身份的服务名称
+	Scopes     []string `json:"scopes,omitempty"`
+	CreatedAt  int64    `json:"createdAt"`            // 创建时间，UTC时间戳
+	ExpiresAt  int64    `json:"expiresAt,omitempty"`  // 过期时间，UTC时间戳，0 表示不过期
+	LastUsedAt int64    `json:"lastUsedAt,omitempty"` // 最近一次通过认证的时间，UTC时间戳
+	RevokedAt  int64    `json:"revokedAt,omitempty"`  // 吊销时间，UTC时间戳
+}
+
+// apiKeyRecord 磁盘上保存的记录，Hash 为密钥随机部分的 SHA-256
+type apiKeyRecord struct {
+	APIKey
+	Hash string `json:"hash"`
+}
+
+type apiKeyFile struct {
+	Keys []apiKeyRecord `json:"keys"`
+}
+
+// APIKeyStore API Key 存储，保存在单个 JSON 文件中；文件被其他进程修改后在下一次校验时自动重新读取，
+// 文件被删除后全部密钥立即失效
+type APIKeyStore struct {
+	mu      sync.Mutex
+	path    string
+	stamp   fileStamp
+	keys    map[string]*apiKeyRecord
+	flushed map[string]int64 // 已写回磁盘的最近使用时间
+	stop    chan struct{}
+}
+
+// NewAPIKeyStore 创建 API Key 存储，文件不存在时在首次创建密钥时生成；
+// 最近使用时间由后台每分钟写回一次，不再使用时调用 Close 停止
+func NewAPIKeyStore(path string) (*APIKeyStore, error) {
+	s := &APIKeyStore{
+		path:    path,
+		keys:    make(map[string]*apiKeyRecord),
+		flushed: make(map[string]int64),
+		stop:    make(chan struct{}),
+	}
+	s.mu.Lock()
+	err := s.reloadLocked()
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ticker := time.NewTicker(lastUsedFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if err := s.Flush(); err != nil {
+					logutil.Println("API Key 最近使用时间写入失败：", err)
+				}
+			}
+		}
+	}()
+	return s, nil
+}
+
+// Flush 把内存中较新的最近使用时间写回磁盘
+func (s *APIKeyStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadLocked(); err != nil {
+		return err
+	}
+	for id, record := range s.keys {
+		if record.LastUsedAt > s.flushed[id] {
+			return s.persistLocked()
+		}
+	}
+	return nil
+}
+
+// Close 写回最近使用时间并停止后台写回
+func (s *APIKeyStore) Close() error {
+	s.mu.Lock()
+	select {
+	case <-s.stop:
+		s.mu.Unlock()
+		return nil
+	default:
+		close(s.stop)
+	}
+	s.mu.Unlock()
+	return s.Flush()
+}
+
+// Create 创建 API Key，返回元数据和完整密钥；完整密钥无法再次获取，ttl 为 0 表示不过期
+func (s *APIKeyStore) Create(name string, scopes []string, ttl time.Duration) (APIKey, string, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return APIKey{}, "", errors.New("api key name is empty")
+	}
+
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return APIKey{}, "", err
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return APIKey{}, "", err
+	}
+	id := hex.EncodeToString(idBytes)
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	now := time.Now()
+	record := &apiKeyRecord{
+		APIKey: APIKey{
+			ID:        id,
+			Name:      name,
+			Scopes:    uniqueStrings(scopes),
+			CreatedAt: now.UnixMilli(),
+		},
+		Hash: hashAPIKeySecret(secret),
+	}
+	if ttl > 0 {
+		record.ExpiresAt = now.Add(ttl).UnixMilli()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadLocked(); err != nil {
+		return APIKey{}, "", err
+	}
+	s.keys[id] = record
+	if err := s.persistLocked(); err != nil {
+		delete(s.keys, id)
+		return APIKey{}, "", err
+	}
+	return record.APIKey, apiKeyPrefix + id + "_" + secret, nil
+}
+
+// List 列出全部 API Key 的元数据，按创建时间排序
+func (s *APIKeyStore) List() ([]APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadLocked(); err != nil {
+		return nil, err
+	}
+
+	list := make([]APIKey, 0, len(s.keys))
+	for _, record := range s.keys {
+		list = append(list, record.APIKey)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt < list[j].CreatedAt })
+	return list, nil
+}
+
+// Revoke 吊销 API Key，吊销后立即失效，记录保留用于审计
+func (s *APIKeyStore) Revoke(id string) (APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadLocked(); err != nil {
+		return APIKey{}, err
+	}
+
+	record, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, ErrAPIKeyNotFound
+	}
+	if record.RevokedAt == 0 {
+		record.RevokedAt = time.Now().UnixMilli()
+		if err := s.persistLocked(); err != nil {
+			record.RevokedAt = 0
+			return APIKey{}, err
+		}
+	}
+	return record.APIKey, nil
+}
+
+// verify 校验完整密钥并更新内存中的最近使用时间，不在请求路径上写文件
+func (s *APIKeyStore) verify(key string, now time.Time) (APIKey, error) {
+	id, secret, ok := parseAPIKey(key)
+	if !ok {
+		return APIKey{}, invalidAPIKey
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reloadLocked(); err != nil {
+		return APIKey{}, err
+	}
+
+	record, ok := s.keys[id]
+	if !ok {
+		return APIKey{}, fmt.Errorf("%w: unknown key %q", unverifiedAPIKey, id)
+	}
+	if subtle.ConstantTimeCompare([]byte(record.Hash), []byte(hashAPIKeySecret(secret))) != 1 {
+		return APIKey{}, fmt.Errorf("%w: key %q", unverifiedAPIKey, id)
+	}
+	if record.RevokedAt != 0 {
+		return APIKey{}, fmt.Errorf("%w: key %q", revokedAPIKey, id)
+	}
+	if record.ExpiresAt != 0 && now.UnixMilli() > record.ExpiresAt {
+		return APIKey{}, fmt.Errorf("%w: key %q", expiredAPIKey, id)
+	}
+
+	record.LastUsedAt = now.UnixMilli()
+	return record.APIKey, nil
+}
+
+// reloadLocked 文件变化时重新读取，保留内存中较新的最近使用时间；文件不存在时清空内存中的密钥
+func (s *APIKeyStore) reloadLocked() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		if len(s.keys) > 0 {
+			logutil.Println("API Key 文件不存在，全部 API Key 失效：", s.path)
+		}
+		s.keys = make(map[string]*apiKeyRecord)
+		s.flushed = make(map[string]int64)
+		s.stamp = fileStamp{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+	if stamp.modTime.Equal(s.stamp.modTime) && stamp.size == s.stamp.size && stamp.mode == s.stamp.mode {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var file apiKeyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("parse api key file %s: %w", s.path, err)
+	}
+
+	keys := make(map[string]*apiKeyRecord, len(file.Keys))
+	for i := range file.Keys {
+		record := &file.Keys[i]
+		if old, ok := s.keys[record.ID]; ok && old.LastUsedAt > record.LastUsedAt {
+			record.LastUsedAt = old.LastUsedAt
+		}
+		if record.LastUsedAt > s.flushed[record.ID] {
+			s.flushed[record.ID] = record.LastUsedAt
+		}
+		keys[record.ID] = record
+	}
+	s.keys = keys
+	s.stamp = stamp
+	return nil
+}
+
+func (s *APIKeyStore) persistLocked() error {
+	file := apiKeyFile{Keys: make([]apiKeyRecord, 0, len(s.keys))}
+	for _, record := range s.keys {
+		file.Keys = append(file.Keys, *record)
+	}
+	sort.Slice(file.Keys, func(i, j int) bool { return file.Keys[i].CreatedAt < file.Keys[j].CreatedAt })
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.path, data, 0600); err != nil {
+		return err
+	}
+	for _, record := range file.Keys {
+		s.flushed[record.ID] = record.LastUsedAt
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.stamp = fileStamp{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+	}
+	return nil
+}
+
+// parseAPIKey 拆分 lnk_<id>_<secret> 格式的完整密钥
+func parseAPIKey(key string) (string, string, bool) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", "", false
+	}
+	id, secret, ok := strings.Cut(key[len(apiKeyPrefix):], "_")
+	if !ok || len(id) == 0 || len(secret) == 0 {
+		return "", "", false
+	}
+	return id, secret, true
+}
+
+func hashAPIKeySecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiKeyOf 从 X-LincService-API-Key 或 Authorization: ApiKey 头部读取 API Key
+func apiKeyOf(req *http.Request) (string, bool) {
+	if value := req.Header.Get(headerAPIKey); len(value) > 0 {
+		return strings.TrimSpace(value), true
+	}
+	value := req.Header.Get(headerAuthorization)
+	if len(value) <= len(apiKeyScheme) || !strings.EqualFold(value[:len(apiKeyScheme)], apiKeyScheme) {
+		return "", false
+	}
+	return strings.TrimSpace(value[len(apiKeyScheme):]), true
+}
+
+/*****************************************************************
+*							认证器
+*****************************************************************/
+
+// SetAPIKeyStore 设置 API Key 存储，设置后认证中间件同时接受 API Key；传入 nil 表示不再接受
+func (a *Authenticator) SetAPIKeyStore(store *APIKeyStore) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.apiKeys = store
+}
+
+// verifyAPIKey 校验 API Key 并映射为调用方身份
+func (a *Authenticator) verifyAPIKey(store *APIKeyStore, key string) (Identity, error) {
+	a.mu.RLock()
+	now := a.now()
+	a.mu.RUnlock()
+
+	apiKey, err := store.verify(key, now)
+	if err != nil {
+		logutil.Println("API Key 校验失败：", err)
+		return Identity{}, err
+	}
+	return Identity{
+		Method:  MethodAPIKey,
+		Service: apiKey.Name,
+		KeyID:   apiKey.ID,
+		Scopes:  apiKey.Scopes,
+	}, nil
+}
+
+/*****************************************************************
+*							管理接口
+*****************************************************************/
+
+var (
+	defaultAPIKeyStore *APIKeyStore
+	defaultAPIKeyOnce  sync.Once
+)
+
+// DefaultAPIKeyFile 默认 API Key 存储文件，位于数据目录下
+func DefaultAPIKeyFile() string {
+	return filepath.Join(datautil.GetRelDataPath(), "apikeys.json")
+}
+
+// DefaultAPIKeyStore 获取默认 API Key 存储
+func DefaultAPIKeyStore() *APIKeyStore {
+	defaultAPIKeyOnce.Do(func() {
+		s, err := NewAPIKeyStore(DefaultAPIKeyFile())
+		if err != nil {
+			panic(err)
+		}
+		defaultAPIKeyStore = s
+	})
+	return defaultAPIKeyStore
+}
+
+// UseAPIKeys 让默认认证器接受数据目录中的 API Key
+func UseAPIKeys() {
+	defaultAuthenticator.SetAPIKeyStore(DefaultAPIKeyStore())
+}
+
+type createAPIKeyRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes"`
+	TTL    string   `json:"ttl"` // 有效期，例如 720h，为空表示不过期
+}
+
+// CreatedAPIKey 创建接口的返回数据，Key 只在此时返回一次
+type CreatedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// RegisterAPIKeyRoutes 在路由组上注册默认 API Key 存储的管理接口，需要通过 InternalServiceAuth 认证且具备管理员身份
+func RegisterAPIKeyRoutes(group *gin.RouterGroup) {
+	g := group.Group("", InternalServiceAuth(), RequireAdmin())
+	g.GET("/apikeys", DefaultAPIKeyStore().ListFunc)
+	g.POST("/apikeys", DefaultAPIKeyStore().CreateFunc)
+	g.DELETE("/apikeys/:id", DefaultAPIKeyStore().RevokeFunc)
+}
+
+// CreateFunc 创建 API Key，请求体包含 name、scopes 和 ttl
+func (s *APIKeyStore) CreateFunc(c *gin.Context) {
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		abortWithAPIKeyError(c, http.StatusBadRequest, 4000, err)
+		return
+	}
+	var ttl time.Duration
+	if len(req.TTL) > 0 {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil || d < 0 {
+			abortWithAPIKeyError(c, http.StatusBadRequest, 4000, fmt.Errorf("invalid ttl %q", req.TTL))
+			return
+		}
+		ttl = d
+	}
+
+	apiKey, key, err := s.Create(req.Name, req.Scopes, ttl)
+	if err != nil {
+		abortWithAPIKeyError(c, http.StatusInternalServerError, 5000, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    CreatedAPIKey{APIKey: apiKey, Key: key},
+	})
+}
+
+// ListFunc 列出全部 API Key 的元数据
+func (s *APIKeyStore) ListFunc(c *gin.Context) {
+	list, err := s.List()
+	if err != nil {
+		abortWithAPIKeyError(c, http.StatusInternalServerError, 5000, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    list,
+	})
+}
+
+// RevokeFunc 吊销路径参数 id 对应的 API Key
+func (s *APIKeyStore) RevokeFunc(c *gin.Context) {
+	apiKey, err := s.Revoke(c.Param("id"))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		abortWithAPIKeyError(c, http.StatusNotFound, 4040, err)
+		return
+	}
+	if err != nil {
+		abortWithAPIKeyError(c, http.StatusInternalServerError, 5000, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    apiKey,
+	})
+}
+
+func abortWithAPIKeyError(c *gin.Context, status int, code int, err error) {
+	c.AbortWithStatusJSON(status, apiutil.Response{
+		Code:    code,
+		Message: err.Error(),
+		Data:    apiutil.EmptyResponse{},
+	})
+}
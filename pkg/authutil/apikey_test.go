@@ -0,0 +1,170 @@
+package authutil_test
+
+import (
+	"encoding/json"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newAPIKeyStore(t *testing.T) (*authutil.APIKeyStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "apikeys.json")
+	store, err := authutil.NewAPIKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+	return store, path
+}
+
+func createAPIKey(t *testing.T, store *authutil.APIKeyStore, name string, ttl time.Duration) (authutil.APIKey, string) {
+	t.Helper()
+	apiKey, key, err := store.Create(name, []string{"orders:read"}, ttl)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return apiKey, key
+}
+
+func TestAPIKeyIdentity(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	store, _ := newAPIKeyStore(t)
+	f.Server.SetAPIKeyStore(store)
+	apiKey, key := createAPIKey(t, store, "partner", 0)
+
+	for _, req := range []*http.Request{
+		requestWith(authutil.HeaderAPIKey, key),
+		requestWith("Authorization", "ApiKey "+key),
+	} {
+		w, identity := serve(t, f.Middleware(), req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body.String())
+		}
+		if identity.Method != authutil.MethodAPIKey || identity.Service != "partner" || identity.KeyID != apiKey.ID ||
+			!reflect.DeepEqual(identity.Scopes, []string{"orders:read"}) || identity.IsPrivileged() {
+			t.Errorf("identity = %+v", identity)
+		}
+	}
+}
+
+func TestAPIKeyRejected(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	store, _ := newAPIKeyStore(t)
+	f.Server.SetAPIKeyStore(store)
+
+	_, valid := createAPIKey(t, store, "partner", 0)
+	revoked, revokedKey := createAPIKey(t, store, "revoked", 0)
+	if _, err := store.Revoke(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, expiredKey := createAPIKey(t, store, "expired", time.Minute)
+	f.Server.SetClock(func() time.Time { return time.Now().Add(time.Hour) })
+
+	tests := []struct {
+		name string
+		key  string
+		code int
+	}{
+		{"malformed", "not-a-key", authutil.CodeAuthMalformed},
+		{"wrong secret", valid[:len(valid)-4] + "AAAA", authutil.CodeAuthUndecryptable},
+		{"revoked", revokedKey, authutil.CodeAuthRevoked},
+		{"expired", expiredKey, authutil.CodeAuthExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, _ := serve(t, f.Middleware(), requestWith(authutil.HeaderAPIKey, tt.key))
+			if code := authtest.ResponseCode(t, w); code != tt.code {
+				t.Errorf("code = %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestAPIKeyFileRemoved(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	store, path := newAPIKeyStore(t)
+	f.Server.SetAPIKeyStore(store)
+	_, key := createAPIKey(t, store, "partner", 0)
+
+	// 删除文件后全部密钥立即失效，其他进程写入的新文件在下一次校验时生效
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := serve(t, f.Middleware(), requestWith(authutil.HeaderAPIKey, key))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("after remove: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+
+	other, otherFile := newAPIKeyStore(t)
+	_, otherKey := createAPIKey(t, other, "partner", 0)
+	if err := other.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(otherFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	w, _ = serve(t, f.Middleware(), requestWith(authutil.HeaderAPIKey, otherKey))
+	if w.Code != http.StatusOK {
+		t.Errorf("after rewrite: status = %d, body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAPIKeyLastUsedFlush(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	store, path := newAPIKeyStore(t)
+	f.Server.SetAPIKeyStore(store)
+	apiKey, key := createAPIKey(t, store, "partner", 0)
+
+	w, _ := serve(t, f.Middleware(), requestWith(authutil.HeaderAPIKey, key))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	// 最近使用时间先只在内存中更新，Flush 或 Close 后才写入文件
+	if lastUsed(t, path, apiKey.ID) != 0 {
+		t.Error("last used written on the request path")
+	}
+	if err := store.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if lastUsed(t, path, apiKey.ID) == 0 {
+		t.Error("last used not flushed")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Errorf("second Close: %v", err)
+	}
+}
+
+// lastUsed 直接读取文件中记录的最近使用时间
+func lastUsed(t *testing.T, path string, id string) int64 {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Keys []authutil.APIKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range file.Keys {
+		if key.ID == id {
+			return key.LastUsedAt
+		}
+	}
+	t.Fatalf("key %s not in file", id)
+	return 0
+}
@@ -4,45 +4,63 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
 	"encoding/base64"
-	"encoding/json"
-	"encoding/pem"
 	"errors"
-	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/atmshang/nuclear-nest/pkg/datautil"
 	"github.com/gin-gonic/gin"
 	"io"
 	"net/http"
+	"path/filepath"
 	"time"
 )
 
 const (
 	headerInternalServiceAuth = "X-LincService-Auth"
 	headerVerifiedByTraefik   = "X-Verified-By-Traefik"
-	validateTime              = time.Second * time.Duration(10) // 十秒内有效
-)
 
-var (
-	emptyAuthHeader   = errors.New("auth header is empty")
-	invalidAuthHeader = errors.New("invalid auth header")
-	expiredAuthHeader = errors.New("auth header is expired")
+	HeaderInternalServiceAuth = headerInternalServiceAuth // 可信访问请求头
+	HeaderVerifiedByTraefik   = headerVerifiedByTraefik   // 网关验证后附加的请求头
+
+	validateTime = time.Second * time.Duration(10) // 十秒内有效
 )
 
 var (
-	publicKey  *rsa.PublicKey
-	privateKey *rsa.PrivateKey
-	debugMode  = true
+	emptyAuthHeader    = errors.New("auth header is empty")
+	invalidAuthHeader  = errors.New("invalid auth header")
+	expiredAuthHeader  = errors.New("auth header is expired")
+	replayedAuthHeader = errors.New("auth header has been replayed")
+	wrongAudience      = errors.New("auth header is for another service")
+
+	undecryptableAuthHeader = errors.New("auth header cannot be decrypted")
 )
 
+// defaultAuthenticator 包级函数使用的默认认证器，不放行任何请求，放行本机等来源需调用 SetBypassRules
+var defaultAuthenticator = NewAuthenticator()
+
+// Default 获取包级函数使用的默认认证器
+func Default() *Authenticator {
+	return defaultAuthenticator
+}
+
 /*****************************************************************
 *							调试模式
 *****************************************************************/
 
 // SetDebugMode 设置调试模式
+//
+// Deprecated: 使用 SetBypassRules 按来源放行
 func SetDebugMode(debug bool) {
-	debugMode = debug
-	logutil.Println("调试模式：", debugMode)
+	defaultAuthenticator.SetDebugMode(debug)
+}
+
+// SetProfile 设置默认认证器的运行环境
+func SetProfile(profile Profile) error {
+	return defaultAuthenticator.SetProfile(profile)
+}
+
+// SetBypassRules 替换默认认证器的放行规则
+func SetBypassRules(rules ...BypassRule) error {
+	return defaultAuthenticator.SetBypassRules(rules...)
 }
 
 /*****************************************************************
@@ -51,84 +69,111 @@ func SetDebugMode(debug bool) {
 
 // SetPublicKey 设置公钥
 func SetPublicKey(pemStr string) error {
-	block, _ := pem.Decode([]byte(pemStr))
-	if block == nil {
-		return errors.New("failed to parse public key")
-	}
+	return defaultAuthenticator.SetPublicKey(pemStr)
+}
 
-	parsedPublicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return errors.New("failed to parse public key")
-	}
+// SetPrivateKey 设置私钥
+func SetPrivateKey(pemStr string) error {
+	return defaultAuthenticator.SetPrivateKey(pemStr)
+}
 
-	var ok bool
-	publicKey, ok = parsedPublicKey.(*rsa.PublicKey)
-	if !ok {
-		return errors.New("not a valid RSA public key")
-	}
+// AddKey 向默认认证器添加密钥
+func AddKey(pemStr string, state KeyState) (string, error) {
+	return defaultAuthenticator.AddKey(pemStr, state)
+}
 
-	return nil
+// AddServiceKey 向默认认证器添加调用方的签名公钥并绑定服务名称
+func AddServiceKey(pemStr string, service string) (string, error) {
+	return defaultAuthenticator.AddServiceKey(pemStr, service)
 }
 
-// SetPrivateKey 设置私钥
-func SetPrivateKey(pemStr string) error {
-	block, _ := pem.Decode([]byte(pemStr))
-	if block == nil {
-		return errors.New("failed to parse private key")
-	}
+// LoadKeyFiles 从数据目录下的 keys 文件夹加载默认认证器的公钥和私钥
+func LoadKeyFiles() error {
+	return defaultAuthenticator.LoadKeyFiles(DefaultKeyFiles())
+}
+
+// WatchKeyFiles 加载数据目录下 keys 文件夹中的密钥，并在文件变化时自动重新加载
+func WatchKeyFiles() error {
+	return defaultAuthenticator.WatchKeyFiles(DefaultKeyFiles(), defaultWatchInterval)
+}
 
-	parsedPrivateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+// UseSharedNonceStore 让默认认证器额外使用数据目录下的共享随机数存储，适用于同一设备上的多进程服务
+func UseSharedNonceStore() error {
+	store, err := NewFileNonceStore(filepath.Join(datautil.GetRelDataPath(), "nonces"))
 	if err != nil {
-		return errors.New("failed to parse private key")
+		return err
 	}
-
-	privateKey = parsedPrivateKey
+	defaultAuthenticator.SetNonceStore(ChainNonceStores(NewMemoryNonceStore(defaultNonceCapacity), store))
 	return nil
 }
 
+// GetAuthStatsFunc 默认认证器的认证结果统计接口
+func GetAuthStatsFunc(c *gin.Context) {
+	defaultAuthenticator.StatsFunc(c)
+}
+
+// GetHealthFunc 默认认证器的健康检查接口，包含密钥文件的加载状态
+func GetHealthFunc(c *gin.Context) {
+	defaultAuthenticator.HealthFunc(c)
+}
+
+// GetKeysFunc 默认认证器的密钥列表接口
+func GetKeysFunc(c *gin.Context) {
+	defaultAuthenticator.KeysFunc(c)
+}
+
 /*****************************************************************
 *							可信访问
 *****************************************************************/
 
+// authToken 可信访问请求头的外层结构，携带加密所用的密钥 ID
+type authToken struct {
+	Alg   string `json:"alg,omitempty"` // 密钥封装算法，为空表示 RSA1_5
+	KeyID string `json:"kid"`
+	Data  string `json:"data"` // RSA 加密后的 AuthHeader，Base64 编码
+}
+
 type AuthHeader struct {
-	Expiration int64 `json:"expiration"` // 过期时间，UTC时间戳
+	Expiration int64    `json:"expiration"`         // 过期时间，UTC时间戳
+	Nonce      string   `json:"nonce,omitempty"`    // 一次性随机数，用于防重放
+	Service    string   `json:"service,omitempty"`  // 调用方服务名称
+	Audience   string   `json:"audience,omitempty"` // 目标服务名称
+	Scopes     []string `json:"scopes,omitempty"`   // 调用方申请的权限范围
 }
 
 // GenerateAuthHeaderValue 生成可信访问的请求头参数
 func GenerateAuthHeaderValue() (string, string) {
-	header := AuthHeader{
-		Expiration: time.Now().Add(validateTime).UnixMilli(),
-	}
-	jsonBytes, err := json.Marshal(header)
-	if err != nil {
-		panic(err)
-	}
+	return defaultAuthenticator.GenerateAuthHeaderValue()
+}
 
-	bytes, err := encryptRSA(jsonBytes)
-	if err != nil {
-		panic(err)
-	}
+// GenerateAuthHeaderValueFor 生成发往 audience 服务的可信访问请求头参数
+func GenerateAuthHeaderValueFor(audience string, scopes ...string) (string, string) {
+	return defaultAuthenticator.GenerateAuthHeaderValueFor(audience, scopes...)
+}
 
-	return headerInternalServiceAuth, base64.StdEncoding.EncodeToString(bytes)
+// IssueToken 使用默认认证器的签名私钥签发 JWT
+func IssueToken(claims Claims) (string, error) {
+	return defaultAuthenticator.IssueToken(claims)
 }
 
-func parseAuthHeaderValue(headerStr string) (AuthHeader, error) {
-	var auth AuthHeader
+// VerifyToken 使用默认认证器的密钥校验 JWT
+func VerifyToken(token string) (Claims, error) {
+	return defaultAuthenticator.VerifyToken(token)
+}
 
-	encryptedBytes, err := base64.StdEncoding.DecodeString(headerStr)
-	if err != nil {
-		return auth, err
-	}
-	jsonStrBytes, err := decryptRSA(encryptedBytes)
-	if err != nil {
-		return auth, err
-	}
+// SetSessionHeader 使用默认认证器的会话为发往 audience 服务的请求写入会话请求头
+func SetSessionHeader(req *http.Request, audience string, scopes ...string) error {
+	return defaultAuthenticator.SetSessionHeader(req, audience, scopes...)
+}
 
-	err = json.Unmarshal(jsonStrBytes, &auth)
-	if err != nil {
-		return auth, err
-	}
-	return auth, nil
+// SetServiceName 设置默认认证器所代表的服务名称
+func SetServiceName(name string) {
+	defaultAuthenticator.SetServiceName(name)
+}
+
+// SetServiceCA 设置默认认证器信任的服务证书 CA
+func SetServiceCA(caPEM string) error {
+	return defaultAuthenticator.SetServiceCA(caPEM)
 }
 
 type verify struct {
@@ -137,172 +182,60 @@ type verify struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
-func verifiedByTraefik(ctx *gin.Context) bool {
-	verifiedStr := ctx.GetHeader(headerInternalServiceAuth)
-	if len(verifiedStr) == 0 {
-		logutil.Println("[verifiedByTraefik] 来自网关的请求头不存在")
-		return false
-	}
-	var encryptedModel EncryptedData
-	err := json.Unmarshal([]byte(verifiedStr), &encryptedModel)
-	if err != nil {
-		logutil.Println("[verifiedByTraefik] 加密的请求头反序列化失败")
-		return false
-	}
-	bytes, err := DecryptAESString(encryptedModel)
-	if err != nil {
-		logutil.Println("[verifiedByTraefik] 加密的请求头解密失败")
-		return false
-	}
-	var verifyModel verify
-	err = json.Unmarshal([]byte(bytes), &verifyModel)
-	if err != nil {
-		logutil.Println("[verifiedByTraefik] 解密的鉴权内容反序列化失败")
-		return false
-	}
-	return true
+// InternalServiceAuth 内部服务间调用的认证中间件,若是经过traefik验证,则直接放行
+func InternalServiceAuth(opts ...MiddlewareOption) gin.HandlerFunc {
+	return defaultAuthenticator.Middleware(opts...)
 }
 
-// InternalServiceAuth 内部服务间调用的认证中间件,若是经过traefik验证,则直接放行
-func InternalServiceAuth() gin.HandlerFunc {
-	return func(ctx *gin.Context) {
-
-		if debugMode {
-			logutil.Println("[InternalServiceAuth] 调试模式放行")
-			ctx.Next()
-			return
-		}
-
-		if verifiedByTraefik(ctx) {
-			ctx.Next()
-			return
-		}
-
-		if verifyByAuthHeader(ctx) {
-			ctx.Next()
-			return
-		}
-
-		ctx.AbortWithStatus(http.StatusUnauthorized)
-		return
-	}
+// SignURL 使用默认认证器的签名私钥生成有过期时间的签名 URL
+func SignURL(method string, rawURL string, ttl time.Duration, opts ...SignURLOption) (string, error) {
+	return defaultAuthenticator.SignURL(method, rawURL, ttl, opts...)
 }
 
-func verifyByAuthHeader(ctx *gin.Context) bool {
-	var header string
-	header = ctx.GetHeader(headerVerifiedByTraefik)
-	if len(header) == 0 {
-		header = ctx.Query(headerVerifiedByTraefik)
-	}
-	if len(header) == 0 {
-		_ = ctx.AbortWithError(http.StatusUnauthorized, emptyAuthHeader)
-		logutil.Println("可信请求的字段不存在")
-		return false
-	}
+// SignedURLAuth 默认认证器的签名 URL 校验中间件
+func SignedURLAuth() gin.HandlerFunc {
+	return defaultAuthenticator.SignedURLAuth()
+}
 
-	authHeader, err := parseAuthHeaderValue(header)
-	if err != nil {
-		_ = ctx.AbortWithError(http.StatusUnauthorized, invalidAuthHeader)
-		logutil.Println("可信请求的解析失败")
-		return false
-	}
+// SetSigningKey 设置默认认证器用于签名请求的私钥
+func SetSigningKey(pemStr string) error {
+	return defaultAuthenticator.SetSigningKey(pemStr)
+}
 
-	if time.Now().After(time.UnixMilli(authHeader.Expiration)) {
-		_ = ctx.AbortWithError(http.StatusUnauthorized, expiredAuthHeader)
-		logutil.Println("可信请求已过期")
-		return false
-	}
-	return true
+// SignRequest 使用默认认证器对请求签名
+func SignRequest(req *http.Request) error {
+	return defaultAuthenticator.SignRequest(req)
 }
 
 /*****************************************************************
 *							加密部分
 *****************************************************************/
 
-func encryptRSA(input []byte) ([]byte, error) {
-	if publicKey == nil {
-		return nil, errors.New("public key is not set")
-	}
-	encryptedData, err := rsa.EncryptPKCS1v15(rand.Reader, publicKey, input)
-	if err != nil {
-		return nil, err
-	}
-	return encryptedData, nil
-}
-
-func decryptRSA(encryptedData []byte) ([]byte, error) {
-	if privateKey == nil {
-		return nil, errors.New("private key is not set")
-	}
-	decryptedData, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, encryptedData)
-	if err != nil {
-		return nil, err
-	}
-	return decryptedData, nil
-}
-
 const (
 	aesKeyLength = 32
 )
 
 func EncryptAESString(input string) (EncryptedData, error) {
-	// Generate a random AES key
-	aesKey := make([]byte, aesKeyLength)
-	_, err := rand.Read(aesKey)
-	if err != nil {
-		return EncryptedData{}, err
-	}
-
-	// Encrypt the input using AES with the generated IV
-	encryptedData, encryptedNonce, err := encryptAES([]byte(input), aesKey)
-	if err != nil {
-		return EncryptedData{}, err
-	}
-
-	// Encrypt the AES key using RSA public key
-	encryptedAESKey, err := encryptRSA(aesKey)
-	if err != nil {
-		return EncryptedData{}, err
-	}
-
-	encrypted := EncryptedData{
-		Data:  base64.StdEncoding.EncodeToString(encryptedData),
-		Key:   base64.StdEncoding.EncodeToString(encryptedAESKey),
-		Nonce: encryptedNonce,
-	}
-	return encrypted, nil
+	return defaultAuthenticator.EncryptAESString(input)
 }
 
 func DecryptAESString(encryptedData EncryptedData) (string, error) {
-	// Decode the base64-encoded data
-	decodedEncryptedData, err := base64.StdEncoding.DecodeString(encryptedData.Data)
-	if err != nil {
-		return "", err
-	}
-
-	decodedEncryptedAESKey, err := base64.StdEncoding.DecodeString(encryptedData.Key)
-	if err != nil {
-		return "", err
-	}
-
-	decodedIv, err := base64.StdEncoding.DecodeString(encryptedData.Nonce)
-	if err != nil {
-		return "", err
-	}
+	return defaultAuthenticator.DecryptAESString(encryptedData)
+}
 
-	// Decrypt the AES key using RSA private key
-	aesKey, err := decryptRSA(decodedEncryptedAESKey)
-	if err != nil {
-		return "", err
-	}
+// EncryptedBody 默认认证器的透明加解密中间件
+func EncryptedBody(opts ...EncryptedBodyOption) gin.HandlerFunc {
+	return defaultAuthenticator.EncryptedBody(opts...)
+}
 
-	// Decrypt the data using AES key and IV
-	decryptedData, err := decryptAES(decodedEncryptedData, aesKey, decodedIv)
-	if err != nil {
-		return "", err
-	}
+// NewEncryptWriter 使用默认认证器的活跃公钥创建流式加密写入器
+func NewEncryptWriter(w io.Writer) (io.WriteCloser, error) {
+	return defaultAuthenticator.NewEncryptWriter(w)
+}
 
-	return string(decryptedData), nil
+// NewDecryptReader 使用默认认证器的私钥创建流式解密读取器
+func NewDecryptReader(r io.Reader) (io.Reader, error) {
+	return defaultAuthenticator.NewDecryptReader(r)
 }
 
 func encryptAES(input []byte, key []byte) ([]byte, string, error) {
@@ -339,6 +272,8 @@ func decryptAES(encryptedData []byte, key []byte, iv []byte) ([]byte, error) {
 }
 
 type EncryptedData struct {
+	Alg     string `json:"alg,omitempty"` // 封装 AES 密钥的算法，为空表示 RSA1_5
+	KeyID   string `json:"kid,omitempty"` // 加密 AES 密钥所用的 RSA 密钥 ID
 	Data    string `json:"data"`
 	Key     string `json:"key"`
 	Nonce   string `json:"nonce"`
@@ -0,0 +1,757 @@
+package authutil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Authenticator 持有独立的密钥、时钟、有效期和放行策略，同一进程中可以同时存在多个身份
+type Authenticator struct {
+	mu         sync.RWMutex
+	keys       *keyRing
+	signer     *signingKey
+	keyWrap    string
+	legacyHdr  bool
+	legacyKW   bool
+	service    string
+	strictAud  bool
+	strictNon  bool
+	nonces     NonceStore
+	debugMode  bool
+	profile    Profile
+	bypass     *bypassPolicy
+	keyFiles   *keyFileLoader
+	maxBody    int64
+	serviceCAs *x509.CertPool
+	apiKeys    *APIKeyStore
+	sessions   *sessionCache
+	validity   time.Duration
+	skew       time.Duration
+	issuers    []string
+	now        func() time.Time
+	metrics    metrics
+}
+
+// NewAuthenticator 创建认证器，运行环境取自环境变量，默认关闭调试模式且不放行任何请求，有效期为十秒
+func NewAuthenticator() *Authenticator {
+	profile := ProfileFromEnv()
+	return &Authenticator{
+		keys:      newKeyRing(),
+		keyWrap:   AlgRSAOAEP256,
+		legacyHdr: profile != ProfileProd,
+		legacyKW:  profile != ProfileProd,
+		nonces:    NewMemoryNonceStore(defaultNonceCapacity),
+		profile:   profile,
+		strictNon: profile == ProfileProd,
+		bypass:    &bypassPolicy{},
+		validity:  validateTime,
+		maxBody:   defaultMaxBodySize,
+		skew:      defaultClockSkew,
+		sessions:  newSessionCache(),
+		now:       time.Now,
+	}
+}
+
+/*****************************************************************
+*							配置
+*****************************************************************/
+
+// SetDebugMode 设置调试模式，调试模式下中间件放行全部请求；生产环境中拒绝开启
+//
+// Deprecated: 使用 SetBypassRules 按来源放行
+func (a *Authenticator) SetDebugMode(debug bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if debug && a.profile == ProfileProd {
+		logutil.Println("生产环境中拒绝开启调试模式")
+		return
+	}
+	a.debugMode = debug
+	logutil.Println("调试模式：", debug)
+}
+
+// SetClock 设置时钟，用于生成和校验过期时间
+func (a *Authenticator) SetClock(now func() time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.now = now
+}
+
+// SetValidity 设置认证信息的有效期
+func (a *Authenticator) SetValidity(validity time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.validity = validity
+}
+
+// SetNonceStore 设置随机数存储，多进程共享时可使用 FileNonceStore
+func (a *Authenticator) SetNonceStore(store NonceStore) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.nonces = store
+}
+
+// SetServiceName 设置本服务的名称，生成请求头时作为调用方，校验请求头时作为期望的受众
+func (a *Authenticator) SetServiceName(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.service = name
+}
+
+// SetRequireAudience 设置是否拒绝未指定受众的请求头，默认为兼容旧调用方而放行
+func (a *Authenticator) SetRequireAudience(require bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.strictAud = require
+}
+
+// SetRequireNonce 设置是否拒绝不带随机数的可信访问请求头；不带随机数的旧格式无法防重放，生产环境中默认拒绝
+func (a *Authenticator) SetRequireNonce(require bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.strictNon = require
+}
+
+// SetKeyWrapAlgorithm 设置加密时使用的密钥封装算法，默认为 RSA-OAEP-256；
+// 接收方尚未升级时可临时设为 RSA1_5。解密时按请求头和 EncryptedData 中的算法标识自动选择
+func (a *Authenticator) SetKeyWrapAlgorithm(alg string) error {
+	if alg != AlgRSAOAEP256 && alg != AlgRSA1_5 {
+		return errUnsupportedAlgorithm
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.keyWrap = alg
+	return nil
+}
+
+// SetLegacyAuthHeader 设置生成可信访问请求头时是否使用旧格式：不带外层结构和密钥 ID 的 RSA1_5 密文。
+// 生产环境以外默认使用旧格式，使尚未升级的接收方在滚动发布期间仍能校验；全部接收方升级后设为 false，改用带密钥 ID 的新格式。
+// 生产环境的接收方默认拒绝 RSA1_5，因此生产环境默认使用新格式
+func (a *Authenticator) SetLegacyAuthHeader(legacy bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.legacyHdr = legacy
+}
+
+// SetAllowLegacyKeyWrap 设置解密时是否接受 RSA1_5 以及不带算法标识的旧数据。RSA1_5 解密失败的方式会泄露填充是否正确，
+// 可被用于 Bleichenbacher 攻击，生产环境中默认拒绝；滚动发布期间仍有旧调用方时可临时开启
+func (a *Authenticator) SetAllowLegacyKeyWrap(allow bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.legacyKW = allow
+}
+
+// SetPublicKey 设置公钥，新公钥成为活跃密钥，原活跃密钥转为退役中
+func (a *Authenticator) SetPublicKey(pemStr string) error {
+	publicKey, err := parseRSAPublicKeyPEM(pemStr)
+	if err != nil {
+		return err
+	}
+	_, err = a.keys.add(publicKey, nil, true, a.currentTime())
+	return err
+}
+
+// SetPrivateKey 设置私钥，用于解密；尚无活跃密钥时成为活跃密钥，否则不改变当前用于加密的活跃密钥。
+// 公钥和私钥可以属于不同的密钥对（用对端的公钥加密、用自己的私钥解密），调用顺序不影响加密所用的公钥
+func (a *Authenticator) SetPrivateKey(pemStr string) error {
+	privateKey, err := parseRSAPrivateKeyPEM(pemStr)
+	if err != nil {
+		return err
+	}
+	_, err = a.keys.add(&privateKey.PublicKey, privateKey, false, a.currentTime())
+	return err
+}
+
+/*****************************************************************
+*							密钥轮换
+*****************************************************************/
+
+// AddKey 添加公钥或私钥 PEM 并返回密钥 ID，state 为 active 时替换当前活跃密钥；
+// 调用方用于签名的公钥以 trusted 状态添加，可以是 RSA、ECDSA P-256 或 Ed25519 密钥
+func (a *Authenticator) AddKey(pemStr string, state KeyState) (string, error) {
+	if state != KeyStateActive && state != KeyStateRetiring && state != KeyStateTrusted {
+		return "", errInvalidKeyState
+	}
+
+	var publicKey crypto.PublicKey
+	privateKey, err := parsePrivateKeyPEM(pemStr)
+	if err == nil {
+		publicKey = privateKey.Public()
+	} else {
+		privateKey = nil
+		publicKey, err = parsePublicKeyPEM(pemStr)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// 活跃密钥用于加密，只能是 RSA 密钥
+	if _, ok := publicKey.(*rsa.PublicKey); !ok && state == KeyStateActive {
+		return "", errNotRSAKey
+	}
+
+	id, err := a.keys.add(publicKey, privateKey, state == KeyStateActive, a.currentTime())
+	if err != nil {
+		return "", err
+	}
+	return id, a.keys.setState(id, state)
+}
+
+// AddServiceKey 以 trusted 状态添加调用方 service 用于签名的公钥，并把密钥绑定到该服务名称；
+// 请求签名中的服务名称必须与之一致，未绑定服务名称的密钥签名的请求不带服务名称
+func (a *Authenticator) AddServiceKey(pemStr string, service string) (string, error) {
+	if len(service) == 0 {
+		return "", errNoServiceName
+	}
+	id, err := a.AddKey(pemStr, KeyStateTrusted)
+	if err != nil {
+		return "", err
+	}
+	return id, a.keys.bind(id, service)
+}
+
+// SetKeyState 修改密钥状态，设为 active 时原活跃密钥转为退役中
+func (a *Authenticator) SetKeyState(id string, state KeyState) error {
+	return a.keys.setState(id, state)
+}
+
+// RemoveKey 移除密钥，移除后携带该密钥 ID 的请求将无法通过校验，由它封装的已缓存会话同时失效
+func (a *Authenticator) RemoveKey(id string) error {
+	if err := a.keys.remove(id); err != nil {
+		return err
+	}
+	a.sessions.purgeKey(id)
+	return nil
+}
+
+// Keys 获取全部密钥的指纹和状态
+func (a *Authenticator) Keys() []KeyInfo {
+	return a.keys.list()
+}
+
+// KeysFunc 密钥列表接口，用于观察轮换进度
+func (a *Authenticator) KeysFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    a.Keys(),
+	})
+}
+
+func (a *Authenticator) currentTime() time.Time {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.now()
+}
+
+/*****************************************************************
+*							可信访问
+*****************************************************************/
+
+// GenerateAuthHeaderValue 生成可信访问的请求头参数，不限定受众
+func (a *Authenticator) GenerateAuthHeaderValue() (string, string) {
+	return a.GenerateAuthHeaderValueFor("")
+}
+
+// GenerateAuthHeaderValueFor 生成发往 audience 服务的可信访问请求头参数，并携带本服务名称和权限范围
+func (a *Authenticator) GenerateAuthHeaderValueFor(audience string, scopes ...string) (string, string) {
+	nonce, err := newNonce()
+	if err != nil {
+		panic(err)
+	}
+
+	a.mu.RLock()
+	header := AuthHeader{
+		Expiration: a.now().Add(a.validity).UnixMilli(),
+		Nonce:      nonce,
+		Service:    a.service,
+		Audience:   audience,
+		Scopes:     scopes,
+	}
+	a.mu.RUnlock()
+
+	jsonBytes, err := json.Marshal(header)
+	if err != nil {
+		panic(err)
+	}
+
+	a.mu.RLock()
+	legacy := a.legacyHdr
+	a.mu.RUnlock()
+	if legacy {
+		bytes, err := a.encryptLegacyHeader(jsonBytes)
+		if err == nil {
+			return headerInternalServiceAuth, base64.StdEncoding.EncodeToString(bytes)
+		}
+		logutil.Println("可信访问请求头无法使用旧格式，改用新格式：", err)
+	}
+
+	alg, keyID, bytes, err := a.encryptRSA(jsonBytes)
+	if err != nil {
+		panic(err)
+	}
+
+	tokenBytes, err := json.Marshal(authToken{
+		Alg:   alg,
+		KeyID: keyID,
+		Data:  base64.StdEncoding.EncodeToString(bytes),
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	return headerInternalServiceAuth, base64.StdEncoding.EncodeToString(tokenBytes)
+}
+
+func (a *Authenticator) parseAuthHeaderValue(headerStr string) (AuthHeader, error) {
+	var auth AuthHeader
+
+	token, encryptedBytes, err := parseAuthToken(headerStr)
+	if err != nil {
+		return auth, fmt.Errorf("%w: %v", invalidAuthHeader, err)
+	}
+	jsonStrBytes, err := a.decryptRSA(encryptedBytes, token.KeyID, token.Alg)
+	if err != nil {
+		return auth, fmt.Errorf("%w: key %q, %s: %v", undecryptableAuthHeader, token.KeyID, token.Alg, err)
+	}
+
+	err = json.Unmarshal(jsonStrBytes, &auth)
+	if err != nil {
+		return auth, fmt.Errorf("%w: %v", invalidAuthHeader, err)
+	}
+	return auth, nil
+}
+
+// parseAuthToken 解析请求头的外层结构，兼容不带密钥 ID 的旧格式
+func parseAuthToken(headerStr string) (authToken, []byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(headerStr)
+	if err != nil {
+		return authToken{}, nil, err
+	}
+
+	var token authToken
+	if len(decoded) > 0 && decoded[0] == '{' && json.Unmarshal(decoded, &token) == nil && len(token.Data) > 0 {
+		encryptedBytes, err := base64.StdEncoding.DecodeString(token.Data)
+		if err != nil {
+			return authToken{}, nil, err
+		}
+		return token, encryptedBytes, nil
+	}
+
+	// 旧格式直接是 RSA1_5 密文
+	return authToken{Alg: AlgRSA1_5}, decoded, nil
+}
+
+// VerifyRequest 校验请求是否来自可信服务：经过 traefik 验证，或携带有效的可信访问请求头
+func (a *Authenticator) VerifyRequest(req *http.Request) error {
+	_, err := a.Authenticate(req)
+	return err
+}
+
+// Authenticate 校验请求并返回调用方身份
+func (a *Authenticator) Authenticate(req *http.Request) (Identity, error) {
+	identity, err := a.authenticate(req)
+	return identity, a.count(err)
+}
+
+// count 按校验结果计数
+func (a *Authenticator) count(err error) error {
+	switch {
+	case err == nil:
+		atomic.AddInt64(&a.metrics.verified, 1)
+	case errors.Is(err, replayedAuthHeader):
+		atomic.AddInt64(&a.metrics.replayed, 1)
+		atomic.AddInt64(&a.metrics.rejected, 1)
+	default:
+		atomic.AddInt64(&a.metrics.rejected, 1)
+	}
+	return err
+}
+
+func (a *Authenticator) authenticate(req *http.Request) (Identity, error) {
+	if verifyModel, ok := a.verifiedByTraefik(req); ok {
+		return Identity{
+			Method:  MethodGateway,
+			UserId:  verifyModel.UserId,
+			IsAdmin: verifyModel.IsAdmin,
+		}, nil
+	}
+	if identity, err := a.verifyPeerCertificate(req); err == nil {
+		return identity, nil
+	}
+	if len(req.Header.Get(headerRequestSignature)) > 0 {
+		return a.verifySignature(req)
+	}
+	if value := req.Header.Get(headerSession); len(value) > 0 {
+		return a.verifySession(req, value)
+	}
+	if token, ok := bearerToken(req); ok {
+		return a.verifyBearerToken(token)
+	}
+	a.mu.RLock()
+	apiKeys := a.apiKeys
+	a.mu.RUnlock()
+	if key, ok := apiKeyOf(req); ok && apiKeys != nil {
+		return a.verifyAPIKey(apiKeys, key)
+	}
+	return a.verifyByAuthHeader(req)
+}
+
+// MiddlewareOption 认证中间件的可选项
+type MiddlewareOption func(*middlewareConfig)
+
+type middlewareConfig struct {
+	requireSignature bool
+	requireMutualTLS bool
+}
+
+// RequireSignature 要求请求必须携带有效的请求签名，网关验证和可信访问请求头都不再放行
+func RequireSignature() MiddlewareOption {
+	return func(config *middlewareConfig) {
+		config.requireSignature = true
+	}
+}
+
+// Middleware 内部服务间调用的认证中间件,若是经过traefik验证,则直接放行；
+// 命中放行规则的请求无需认证，当前配置在生产环境中不安全时直接 panic，使服务无法启动
+func (a *Authenticator) Middleware(opts ...MiddlewareOption) gin.HandlerFunc {
+	if err := a.Validate(); err != nil {
+		panic(err)
+	}
+
+	var config middlewareConfig
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return func(ctx *gin.Context) {
+
+		if identity, ok := a.checkBypass(ctx.Request); ok {
+			SetIdentity(ctx, identity)
+			ctx.Next()
+			return
+		}
+
+		authenticate := a.Authenticate
+		if config.requireSignature {
+			authenticate = a.AuthenticateSignedRequest
+		}
+		if config.requireMutualTLS {
+			authenticate = a.AuthenticateMutualTLS
+		}
+		identity, err := authenticate(ctx.Request)
+		if err != nil {
+			a.abortWithFailure(ctx, err)
+			return
+		}
+
+		SetIdentity(ctx, identity)
+		ctx.Next()
+	}
+}
+
+func (a *Authenticator) verifiedByTraefik(req *http.Request) (verify, bool) {
+	var verifyModel verify
+	verifiedStr := gatewayHeaderValue(req)
+	if len(verifiedStr) == 0 {
+		logutil.Println("[verifiedByTraefik] 来自网关的请求头不存在")
+		return verifyModel, false
+	}
+	var encryptedModel EncryptedData
+	err := json.Unmarshal([]byte(verifiedStr), &encryptedModel)
+	if err != nil {
+		logutil.Println("[verifiedByTraefik] 加密的请求头反序列化失败")
+		return verifyModel, false
+	}
+	bytes, err := a.DecryptAESString(encryptedModel)
+	if err != nil {
+		logutil.Println("[verifiedByTraefik] 加密的请求头解密失败")
+		return verifyModel, false
+	}
+	err = json.Unmarshal([]byte(bytes), &verifyModel)
+	if err != nil {
+		logutil.Println("[verifiedByTraefik] 解密的鉴权内容反序列化失败")
+		return verifyModel, false
+	}
+	return verifyModel, true
+}
+
+// gatewayHeaderValue 读取网关附加的 verify 内容。早期版本的网关把它放在 X-LincService-Auth 中，
+// 兼容期内两个请求头都接受，按内容区分：verify 内容是 JSON，可信访问请求头是 base64
+func gatewayHeaderValue(req *http.Request) string {
+	for _, name := range []string{headerVerifiedByTraefik, headerInternalServiceAuth} {
+		if value := req.Header.Get(name); isGatewayPayload(value) {
+			if name != headerVerifiedByTraefik {
+				logutil.Println("网关的 verify 内容放在 " + name + " 中已弃用，请改用 " + headerVerifiedByTraefik)
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+// authHeaderValue 读取可信访问请求头。早期版本的接收方从 X-Verified-By-Traefik 读取，
+// 兼容期内两个请求头都接受，已升级的调用方使用 X-LincService-Auth
+func authHeaderValue(req *http.Request) string {
+	for _, name := range []string{headerInternalServiceAuth, headerVerifiedByTraefik} {
+		if value := req.Header.Get(name); len(value) > 0 && !isGatewayPayload(value) {
+			if name != headerInternalServiceAuth {
+				logutil.Println("可信访问信息放在 " + name + " 中已弃用，请改用 " + headerInternalServiceAuth)
+			}
+			return value
+		}
+	}
+	return ""
+}
+
+func isGatewayPayload(value string) bool {
+	return strings.HasPrefix(strings.TrimSpace(value), "{")
+}
+
+func (a *Authenticator) verifyByAuthHeader(req *http.Request) (Identity, error) {
+	header := authHeaderValue(req)
+	if len(header) == 0 {
+		header = a.authQueryValue(req)
+	}
+	if len(header) == 0 {
+		logutil.Println("可信请求的字段不存在")
+		return Identity{}, emptyAuthHeader
+	}
+
+	authHeader, err := a.parseAuthHeaderValue(header)
+	if err != nil {
+		logutil.Println("可信请求的解析失败：", err)
+		return Identity{}, err
+	}
+
+	a.mu.RLock()
+	now, validity, skew := a.now(), a.validity, a.skew
+	a.mu.RUnlock()
+
+	expiration := time.UnixMilli(authHeader.Expiration)
+	if now.After(expiration) {
+		logutil.Println("可信请求已过期")
+		return Identity{}, fmt.Errorf("%w: expired %s ago", expiredAuthHeader, now.Sub(expiration).Round(time.Millisecond))
+	}
+	// 持有公钥即可生成请求头，过期时间必须限制在有效期加时钟误差以内，否则随机数会被长期保存，存储被灌满后拒绝全部请求
+	if latest := now.Add(validity + skew); expiration.After(latest) {
+		logutil.Println("可信请求的过期时间超出有效期")
+		return Identity{}, fmt.Errorf("%w: expires %s after the allowed validity", invalidAuthHeader, expiration.Sub(latest).Round(time.Millisecond))
+	}
+
+	if err := a.checkAudience(authHeader.Audience); err != nil {
+		logutil.Println("可信请求的受众不匹配：", authHeader.Audience)
+		return Identity{}, err
+	}
+
+	a.mu.RLock()
+	strictNonce := a.strictNon
+	a.mu.RUnlock()
+	if strictNonce && len(authHeader.Nonce) == 0 {
+		logutil.Println("可信请求不带随机数")
+		return Identity{}, fmt.Errorf("%w: nonce is missing", invalidAuthHeader)
+	}
+	if err := a.checkNonce(authHeader.Nonce, expiration); err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Method:  MethodHeader,
+		Service: authHeader.Service,
+		Scopes:  authHeader.Scopes,
+	}, nil
+}
+
+// authQueryValue 兼容旧调用方把可信访问请求头放在查询参数中的做法；完整的认证信息会出现在访问日志和浏览器历史中，
+// 只有显式设置为 dev 或 test 的运行环境才接受，下载和分享链接请改用 SignURL
+func (a *Authenticator) authQueryValue(req *http.Request) string {
+	query := req.URL.Query()
+	value := query.Get(headerInternalServiceAuth)
+	if len(value) == 0 {
+		value = query.Get(headerVerifiedByTraefik)
+	}
+	if len(value) == 0 {
+		return ""
+	}
+	if profile := a.Profile(); profile != ProfileDev && profile != ProfileTest {
+		logutil.Println("拒绝查询参数中的可信访问信息，请改用签名 URL：", req.URL.Path)
+		return ""
+	}
+	logutil.Println("可信访问信息放在查询参数中已弃用，请改用签名 URL：", req.URL.Path)
+	return value
+}
+
+// checkAudience 受众必须与本服务名称一致；本服务未设置名称时不校验
+func (a *Authenticator) checkAudience(audience string) error {
+	a.mu.RLock()
+	service, strict := a.service, a.strictAud
+	a.mu.RUnlock()
+
+	if len(service) == 0 {
+		return nil
+	}
+	if len(audience) == 0 {
+		if strict {
+			return fmt.Errorf("%w: audience is missing", wrongAudience)
+		}
+		return nil
+	}
+	if audience != service {
+		return fmt.Errorf("%w: want %q, got %q", wrongAudience, service, audience)
+	}
+	return nil
+}
+
+// checkNonce 校验随机数是否已在有效期内出现过，随机数为空时直接放行，是否要求随机数由调用处决定
+func (a *Authenticator) checkNonce(nonce string, expiration time.Time) error {
+	if len(nonce) == 0 {
+		return nil
+	}
+
+	a.mu.RLock()
+	store := a.nonces
+	a.mu.RUnlock()
+
+	fresh, err := store.Remember(nonce, expiration)
+	if err != nil {
+		logutil.Println("可信请求的随机数记录失败：", err)
+		return err
+	}
+	if !fresh {
+		logutil.Println("可信请求被重放")
+		return replayedAuthHeader
+	}
+	return nil
+}
+
+/*****************************************************************
+*							加密部分
+*****************************************************************/
+
+// encryptRSA 使用活跃公钥和配置的封装算法加密，返回所用的算法和密钥 ID
+func (a *Authenticator) encryptRSA(input []byte) (string, string, []byte, error) {
+	keyID, publicKey, err := a.keys.active()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	a.mu.RLock()
+	alg := a.keyWrap
+	a.mu.RUnlock()
+
+	encryptedData, err := wrapKey(alg, publicKey, input)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return alg, keyID, encryptedData, nil
+}
+
+// encryptLegacyHeader 旧格式的请求头直接是活跃公钥加密的 RSA1_5 密文，内容过长时返回错误
+func (a *Authenticator) encryptLegacyHeader(input []byte) ([]byte, error) {
+	_, publicKey, err := a.keys.active()
+	if err != nil {
+		return nil, err
+	}
+	return wrapKey(AlgRSA1_5, publicKey, input)
+}
+
+// decryptRSA 使用密钥 ID 对应的私钥解密，keyID 为空时依次尝试全部私钥
+func (a *Authenticator) decryptRSA(encryptedData []byte, keyID string, alg string) ([]byte, error) {
+	a.mu.RLock()
+	allowLegacy := a.legacyKW
+	a.mu.RUnlock()
+	if !allowLegacy && (alg == AlgRSA1_5 || len(alg) == 0) {
+		return nil, errLegacyKeyWrap
+	}
+
+	privateKeys, err := a.keys.privateKeys(keyID)
+	if err != nil {
+		return nil, err
+	}
+	for _, privateKey := range privateKeys {
+		decryptedData, decryptErr := unwrapKey(alg, privateKey, encryptedData)
+		if decryptErr == nil {
+			return decryptedData, nil
+		}
+		err = decryptErr
+	}
+	return nil, err
+}
+
+// EncryptAESString 使用随机 AES 密钥加密数据，AES 密钥再用公钥加密
+func (a *Authenticator) EncryptAESString(input string) (EncryptedData, error) {
+	// Generate a random AES key
+	aesKey := make([]byte, aesKeyLength)
+	_, err := rand.Read(aesKey)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+
+	// Encrypt the input using AES with the generated IV
+	encryptedData, encryptedNonce, err := encryptAES([]byte(input), aesKey)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+
+	// Encrypt the AES key using RSA public key
+	alg, keyID, encryptedAESKey, err := a.encryptRSA(aesKey)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+
+	encrypted := EncryptedData{
+		Alg:   alg,
+		KeyID: keyID,
+		Data:  base64.StdEncoding.EncodeToString(encryptedData),
+		Key:   base64.StdEncoding.EncodeToString(encryptedAESKey),
+		Nonce: encryptedNonce,
+	}
+	return encrypted, nil
+}
+
+// DecryptAESString 使用私钥解出 AES 密钥，再解密数据
+func (a *Authenticator) DecryptAESString(encryptedData EncryptedData) (string, error) {
+	// Decode the base64-encoded data
+	decodedEncryptedData, err := base64.StdEncoding.DecodeString(encryptedData.Data)
+	if err != nil {
+		return "", err
+	}
+
+	decodedEncryptedAESKey, err := base64.StdEncoding.DecodeString(encryptedData.Key)
+	if err != nil {
+		return "", err
+	}
+
+	decodedIv, err := base64.StdEncoding.DecodeString(encryptedData.Nonce)
+	if err != nil {
+		return "", err
+	}
+
+	// Decrypt the AES key using RSA private key
+	aesKey, err := a.decryptRSA(decodedEncryptedAESKey, encryptedData.KeyID, encryptedData.Alg)
+	if err != nil {
+		return "", err
+	}
+
+	// Decrypt the data using AES key and IV
+	decryptedData, err := decryptAES(decodedEncryptedData, aesKey, decodedIv)
+	if err != nil {
+		return "", err
+	}
+
+	return string(decryptedData), nil
+}
@@ -0,0 +1,234 @@
+// Package authtest 为 InternalServiceAuth 保护的处理函数提供测试工具：生成只存在于内存中的临时密钥，
+// 安装到相互独立的认证器上，并生成有效、过期、篡改和重放的请求头以及网关的 verify 内容，
+// 测试无需开启调试模式，也无需在仓库中保存真实密钥
+package authtest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// keyBits 测试密钥的长度，只用于测试，优先考虑生成速度
+const keyBits = 2048
+
+var (
+	keyOnce    sync.Once
+	privatePEM string
+	publicPEM  string
+	keyErr     error
+)
+
+// ephemeralKeys 同一测试进程内的全部 Fixture 共用一对临时密钥，避免每个测试都生成 RSA 密钥
+func ephemeralKeys() (string, string, error) {
+	keyOnce.Do(func() {
+		privatePEM, publicPEM, keyErr = authutil.GenerateRSAKeyPair(keyBits)
+	})
+	return privatePEM, publicPEM, keyErr
+}
+
+// Fixture 测试用的接收方和调用方认证器，二者共用一对临时密钥
+type Fixture struct {
+	Server *authutil.Authenticator // 接收方，持有私钥，用于中间件
+	Client *authutil.Authenticator // 调用方，只持有公钥，用于生成请求头
+
+	PrivateKeyPEM string
+	PublicKeyPEM  string
+	KeyID         string
+
+	tb testing.TB
+}
+
+// Option Fixture 的可选项
+type Option func(*Fixture)
+
+// WithService 设置接收方的服务名称，用于测试受众校验
+func WithService(name string) Option {
+	return func(f *Fixture) {
+		f.Server.SetServiceName(name)
+	}
+}
+
+// WithCaller 设置调用方的服务名称，生成的请求头会携带该名称
+func WithCaller(name string) Option {
+	return func(f *Fixture) {
+		f.Client.SetServiceName(name)
+	}
+}
+
+// New 创建测试用的认证器，出错时直接结束测试
+func New(tb testing.TB, opts ...Option) *Fixture {
+	tb.Helper()
+
+	private, public, err := ephemeralKeys()
+	if err != nil {
+		tb.Fatalf("authtest: generate key pair: %v", err)
+	}
+
+	f := &Fixture{
+		Server:        authutil.NewAuthenticator(),
+		Client:        authutil.NewAuthenticator(),
+		PrivateKeyPEM: private,
+		PublicKeyPEM:  public,
+		tb:            tb,
+	}
+	if f.KeyID, err = f.Server.AddKey(private, authutil.KeyStateActive); err != nil {
+		tb.Fatalf("authtest: install private key: %v", err)
+	}
+	if err := f.Client.SetPublicKey(public); err != nil {
+		tb.Fatalf("authtest: install public key: %v", err)
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// InstallDefault 把临时密钥安装到 authutil 的默认认证器，使通过 authutil.InternalServiceAuth 注册的路由接受本 Fixture 的请求头；
+// 测试结束时移除该密钥。默认认证器是全局状态，使用它的测试不能并行运行
+func (f *Fixture) InstallDefault() {
+	f.tb.Helper()
+	id, err := authutil.Default().AddKey(f.PrivateKeyPEM, authutil.KeyStateActive)
+	if err != nil {
+		f.tb.Fatalf("authtest: install key on default authenticator: %v", err)
+	}
+	f.tb.Cleanup(func() {
+		_ = authutil.Default().RemoveKey(id)
+	})
+}
+
+// Middleware 接收方认证器的中间件
+func (f *Fixture) Middleware(opts ...authutil.MiddlewareOption) gin.HandlerFunc {
+	return f.Server.Middleware(opts...)
+}
+
+/*****************************************************************
+*							请求头
+*****************************************************************/
+
+// ValidHeader 生成发往 audience 服务的有效请求头，audience 为空表示不限定受众
+func (f *Fixture) ValidHeader(audience string, scopes ...string) (string, string) {
+	return f.Client.GenerateAuthHeaderValueFor(audience, scopes...)
+}
+
+// ExpiredHeader 生成一小时前签发、早已过期的请求头；固定使用新格式，
+// 任何环境的接收方都能解密并判定为过期，而不是因拒绝 RSA1_5 而判定为无法解密
+func (f *Fixture) ExpiredHeader(audience string) (string, string) {
+	f.tb.Helper()
+	caller := authutil.NewAuthenticator()
+	if err := caller.SetPublicKey(f.PublicKeyPEM); err != nil {
+		f.tb.Fatalf("authtest: install public key: %v", err)
+	}
+	caller.SetLegacyAuthHeader(false)
+	issuedAt := time.Now().Add(-time.Hour)
+	caller.SetClock(func() time.Time { return issuedAt })
+	return caller.GenerateAuthHeaderValueFor(audience)
+}
+
+// authToken 请求头的外层结构，与 authutil 保持一致
+type authToken struct {
+	Alg   string `json:"alg,omitempty"`
+	KeyID string `json:"kid"`
+	Data  string `json:"data"`
+}
+
+// TamperedHeader 生成密文被改动过一个字节的请求头，接收方无法解密；新旧两种格式都支持
+func (f *Fixture) TamperedHeader(audience string) (string, string) {
+	f.tb.Helper()
+	name, value := f.ValidHeader(audience)
+
+	outer, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		f.tb.Fatalf("authtest: decode header: %v", err)
+	}
+	var token authToken
+	if len(outer) == 0 || outer[0] != '{' {
+		// 旧格式直接是密文
+		outer[len(outer)/2] ^= 0xff
+		return name, base64.StdEncoding.EncodeToString(outer)
+	}
+	if err := json.Unmarshal(outer, &token); err != nil {
+		f.tb.Fatalf("authtest: parse header: %v", err)
+	}
+	data, err := base64.StdEncoding.DecodeString(token.Data)
+	if err != nil {
+		f.tb.Fatalf("authtest: decode header data: %v", err)
+	}
+	data[len(data)/2] ^= 0xff
+	token.Data = base64.StdEncoding.EncodeToString(data)
+
+	tampered, err := json.Marshal(token)
+	if err != nil {
+		f.tb.Fatalf("authtest: encode header: %v", err)
+	}
+	return name, base64.StdEncoding.EncodeToString(tampered)
+}
+
+// MalformedHeader 生成无法解析的请求头
+func (f *Fixture) MalformedHeader() (string, string) {
+	return authutil.HeaderInternalServiceAuth, "not a valid auth header"
+}
+
+// ReplayedHeader 生成一个已经被接收方认证器接受过一次的请求头，再次使用时会被判定为重放
+func (f *Fixture) ReplayedHeader(audience string) (string, string) {
+	f.tb.Helper()
+	name, value := f.ValidHeader(audience)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(name, value)
+	if _, err := f.Server.Authenticate(req); err != nil {
+		f.tb.Fatalf("authtest: first use of header failed: %v", err)
+	}
+	return name, value
+}
+
+// GatewayHeader 生成网关验证后附加的 verify 请求头，Timestamp 为当前时间
+func (f *Fixture) GatewayHeader(userId string, isAdmin bool) (string, string) {
+	f.tb.Helper()
+	payload, err := json.Marshal(map[string]interface{}{
+		"userId":    userId,
+		"isAdmin":   isAdmin,
+		"timestamp": time.Now(),
+	})
+	if err != nil {
+		f.tb.Fatalf("authtest: encode verify payload: %v", err)
+	}
+	encrypted, err := f.Client.EncryptAESString(string(payload))
+	if err != nil {
+		f.tb.Fatalf("authtest: encrypt verify payload: %v", err)
+	}
+	value, err := json.Marshal(encrypted)
+	if err != nil {
+		f.tb.Fatalf("authtest: encode verify header: %v", err)
+	}
+	return authutil.HeaderVerifiedByTraefik, string(value)
+}
+
+/*****************************************************************
+*							请求与结果
+*****************************************************************/
+
+// NewRequest 创建携带有效请求头的测试请求，不限定受众
+func (f *Fixture) NewRequest(method string, target string, body io.Reader) *http.Request {
+	req := httptest.NewRequest(method, target, body)
+	name, value := f.ValidHeader("")
+	req.Header.Set(name, value)
+	return req
+}
+
+// ResponseCode 解析标准返回体中的 code，用于断言认证失败的具体原因，例如 authutil.CodeAuthExpired
+func ResponseCode(tb testing.TB, w *httptest.ResponseRecorder) int {
+	tb.Helper()
+	var resp apiutil.Response
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		tb.Fatalf("authtest: parse response body %q: %v", w.Body.String(), err)
+	}
+	return resp.Code
+}
@@ -0,0 +1,106 @@
+package authtest_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func serve(middleware gin.HandlerFunc, req *http.Request) (*httptest.ResponseRecorder, authutil.Identity) {
+	var identity authutil.Identity
+	r := gin.New()
+	r.Any("/*path", middleware, func(c *gin.Context) {
+		identity, _ = authutil.GetIdentity(c)
+		c.JSON(http.StatusOK, apiutil.Response{Code: 2000, Message: "", Data: apiutil.EmptyResponse{}})
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w, identity
+}
+
+func TestFixtureHeaders(t *testing.T) {
+	for _, profile := range []authutil.Profile{authutil.ProfileDev, authutil.ProfileProd} {
+		t.Run(string(profile), func(t *testing.T) {
+			// 环境变量未设置时调用方默认使用旧格式，ExpiredHeader 仍须在生产环境判定为过期
+			t.Setenv(authutil.EnvProfile, "")
+			f := authtest.New(t, authtest.WithService("inventory"), authtest.WithCaller("billing"))
+			if err := f.Server.SetProfile(profile); err != nil {
+				t.Fatal(err)
+			}
+			f.Client.SetLegacyAuthHeader(profile != authutil.ProfileProd)
+
+			// 生产环境隐藏格式错误与无法解密的区别
+			malformed := authutil.CodeAuthMalformed
+			if profile == authutil.ProfileProd {
+				malformed = authutil.CodeAuthUndecryptable
+			}
+			tests := []struct {
+				name   string
+				header func() (string, string)
+				code   int
+			}{
+				{"valid", func() (string, string) { return f.ValidHeader("inventory") }, 2000},
+				{"expired", func() (string, string) { return f.ExpiredHeader("inventory") }, authutil.CodeAuthExpired},
+				{"tampered", func() (string, string) { return f.TamperedHeader("inventory") }, authutil.CodeAuthUndecryptable},
+				{"malformed", f.MalformedHeader, malformed},
+				{"replayed", func() (string, string) { return f.ReplayedHeader("inventory") }, authutil.CodeAuthReplayed},
+				{"wrong audience", func() (string, string) { return f.ValidHeader("orders") }, authutil.CodeAuthWrongAudience},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					name, value := tt.header()
+					req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+					req.Header.Set(name, value)
+					w, identity := serve(f.Middleware(), req)
+					if code := authtest.ResponseCode(t, w); code != tt.code {
+						t.Errorf("code = %d, want %d", code, tt.code)
+					}
+					if tt.code == 2000 && (identity.Method != authutil.MethodHeader || identity.Service != "billing") {
+						t.Errorf("identity = %+v", identity)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestFixtureGatewayHeader(t *testing.T) {
+	f := authtest.New(t)
+	name, value := f.GatewayHeader("42", true)
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set(name, value)
+	w, identity := serve(f.Middleware(), req)
+	if w.Code != http.StatusOK || identity.Method != authutil.MethodGateway || identity.UserId != "42" || !identity.IsAdmin {
+		t.Errorf("status = %d, identity = %+v", w.Code, identity)
+	}
+}
+
+func TestFixtureIsolated(t *testing.T) {
+	a := authtest.New(t)
+	b := authtest.New(t)
+	req := a.NewRequest(http.MethodGet, "/orders", nil)
+	if w, _ := serve(a.Middleware(), req); w.Code != http.StatusOK {
+		t.Fatalf("own fixture: status = %d", w.Code)
+	}
+	// 同一请求头在另一个 Fixture 上不会被判定为重放，各自的防重放状态相互独立
+	if w, _ := serve(b.Middleware(), req); w.Code != http.StatusOK {
+		t.Errorf("other fixture: status = %d, body %s", w.Code, w.Body.String())
+	}
+}
+
+func TestInstallDefault(t *testing.T) {
+	f := authtest.New(t)
+	f.InstallDefault()
+	w, identity := serve(authutil.InternalServiceAuth(), f.NewRequest(http.MethodGet, "/orders", nil))
+	if w.Code != http.StatusOK || identity.Method != authutil.MethodHeader {
+		t.Errorf("status = %d, identity = %+v, body %s", w.Code, identity, w.Body.String())
+	}
+}
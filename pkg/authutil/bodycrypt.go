@@ -0,0 +1,415 @@
+package authutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/gin-gonic/gin"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// ContentTypeEncrypted 请求体或返回体是 EncryptedData 时使用的类型，Accept 中包含它表示要求加密返回体
+	ContentTypeEncrypted = "application/vnd.linc.encrypted+json"
+
+	headerInnerContentType = "X-LincService-Content-Type" // 加密前的内容类型
+	headerResponseKey      = "X-LincService-Response-Key" // 加密返回体所用的公钥：密钥 ID 或 base64 编码的 PKIX 公钥
+
+	// AlgDirect 返回体直接使用请求体的 AES 密钥加密，EncryptedData 中不带 Key
+	AlgDirect = "dir"
+
+	defaultMaxEncryptedBody = 32 << 20
+)
+
+var errNoResponseKey = errors.New("no key to encrypt response")
+
+// EncryptedBodyOption 加密请求体中间件的可选项
+type EncryptedBodyOption func(*encryptedBodyConfig)
+
+type encryptedBodyConfig struct {
+	requireRequest  bool
+	requireResponse bool
+	maxBody         int64
+}
+
+// RequireEncryptedRequest 拒绝未加密的请求体
+func RequireEncryptedRequest() EncryptedBodyOption {
+	return func(config *encryptedBodyConfig) {
+		config.requireRequest = true
+	}
+}
+
+// RequireEncryptedResponse 无论客户端是否要求都加密返回体，无法确定加密密钥时返回 400
+func RequireEncryptedResponse() EncryptedBodyOption {
+	return func(config *encryptedBodyConfig) {
+		config.requireResponse = true
+	}
+}
+
+// WithMaxEncryptedBody 限制加密请求体的大小，默认为 32MB
+func WithMaxEncryptedBody(size int64) EncryptedBodyOption {
+	return func(config *encryptedBodyConfig) {
+		config.maxBody = size
+	}
+}
+
+func isEncryptedContentType(value string) bool {
+	mediaType, _, err := mime.ParseMediaType(value)
+	return err == nil && mediaType == ContentTypeEncrypted
+}
+
+func acceptsEncrypted(req *http.Request) bool {
+	for _, part := range strings.Split(req.Header.Get("Accept"), ",") {
+		if isEncryptedContentType(strings.TrimSpace(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptedBody 透明加解密中间件，按路由启用：
+// Content-Type 为 ContentTypeEncrypted 的请求体在绑定前解密，内容类型还原为 X-LincService-Content-Type（默认 application/json）；
+// Accept 包含 ContentTypeEncrypted 时加密返回体，密钥取自 X-LincService-Response-Key，未提供时沿用请求体的 AES 密钥
+func (a *Authenticator) EncryptedBody(opts ...EncryptedBodyOption) gin.HandlerFunc {
+	config := encryptedBodyConfig{maxBody: defaultMaxEncryptedBody}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return func(ctx *gin.Context) {
+		var requestKey []byte
+		if isEncryptedContentType(ctx.ContentType()) {
+			key, err := a.decryptRequestBody(ctx.Request, config.maxBody)
+			if err != nil {
+				logutil.Println("[EncryptedBody] 请求体解密失败：", err)
+				abortWithBadRequest(ctx, "Failed to decrypt request body")
+				return
+			}
+			requestKey = key
+		} else if config.requireRequest && ctx.Request.ContentLength != 0 {
+			abortWithBadRequest(ctx, "Request body must be encrypted")
+			return
+		}
+
+		if !config.requireResponse && !acceptsEncrypted(ctx.Request) {
+			ctx.Next()
+			return
+		}
+
+		seal, err := a.responseSealer(ctx.Request, requestKey)
+		if err != nil {
+			logutil.Println("[EncryptedBody] 无法确定返回体的加密密钥：", err)
+			abortWithBadRequest(ctx, "No key to encrypt response")
+			return
+		}
+
+		writer := &bufferedResponseWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+		func() {
+			// 处理函数 panic 时同样还原，外层的恢复中间件才能把 500 直接写给客户端
+			defer func() { ctx.Writer = writer.ResponseWriter }()
+			ctx.Next()
+		}()
+
+		if !bodyAllowed(ctx.Request.Method, writer.Status()) {
+			writer.ResponseWriter.WriteHeaderNow()
+			return
+		}
+
+		encrypted, err := seal(writer.body.Bytes())
+		if err != nil {
+			logutil.Println("[EncryptedBody] 返回体加密失败：", err)
+			ctx.AbortWithStatusJSON(http.StatusInternalServerError, apiutil.Response{
+				Code:    5000,
+				Message: "Failed to encrypt response",
+				Data:    apiutil.EmptyResponse{},
+			})
+			return
+		}
+		data, err := json.Marshal(encrypted)
+		if err != nil {
+			panic(err)
+		}
+
+		header := writer.ResponseWriter.Header()
+		if inner := header.Get("Content-Type"); len(inner) > 0 {
+			header.Set(headerInnerContentType, inner)
+		}
+		header.Set("Content-Type", ContentTypeEncrypted)
+		header.Set("Content-Length", strconv.Itoa(len(data)))
+		header.Add("Vary", "Accept")
+		writer.ResponseWriter.WriteHeader(writer.Status())
+		_, _ = writer.ResponseWriter.Write(data)
+	}
+}
+
+// bodyAllowed 判断返回是否可以携带返回体，1xx/204/304 与 HEAD 请求原样透传，不加密
+func bodyAllowed(method string, status int) bool {
+	if method == http.MethodHead {
+		return false
+	}
+	return status >= http.StatusOK && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+func abortWithBadRequest(ctx *gin.Context, message string) {
+	ctx.AbortWithStatusJSON(http.StatusBadRequest, apiutil.Response{
+		Code:    4000,
+		Message: message,
+		Data:    apiutil.EmptyResponse{},
+	})
+}
+
+// decryptRequestBody 解密请求体并替换，返回请求体的 AES 密钥供加密返回体使用
+func (a *Authenticator) decryptRequestBody(req *http.Request, maxBody int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBody+1))
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > maxBody {
+		return nil, errors.New("encrypted body is too large")
+	}
+
+	var encrypted EncryptedData
+	if err := json.Unmarshal(body, &encrypted); err != nil {
+		return nil, err
+	}
+	plaintext, key, err := a.decryptEncryptedData(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := req.Header.Get(headerInnerContentType)
+	if len(contentType) == 0 {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Del(headerInnerContentType)
+	req.Body = io.NopCloser(bytes.NewReader(plaintext))
+	req.ContentLength = int64(len(plaintext))
+	req.Header.Set("Content-Length", strconv.Itoa(len(plaintext)))
+	return key, nil
+}
+
+// responseSealer 确定返回体的加密方式：客户端提供的公钥优先，其次沿用请求体的 AES 密钥
+func (a *Authenticator) responseSealer(req *http.Request, requestKey []byte) (func([]byte) (EncryptedData, error), error) {
+	if value := req.Header.Get(headerResponseKey); len(value) > 0 {
+		keyID, publicKey, err := a.responsePublicKey(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(plaintext []byte) (EncryptedData, error) {
+			return a.encryptWithPublicKey(plaintext, keyID, publicKey)
+		}, nil
+	}
+	if requestKey != nil {
+		return func(plaintext []byte) (EncryptedData, error) {
+			return EncryptWithKey(plaintext, requestKey)
+		}, nil
+	}
+	return nil, errNoResponseKey
+}
+
+// responsePublicKey 解析客户端提供的公钥：密钥环中的密钥 ID，或 base64 编码的 PKIX RSA 公钥
+func (a *Authenticator) responsePublicKey(value string) (string, *rsa.PublicKey, error) {
+	if publicKey, err := a.keys.publicKey(value); err == nil {
+		rsaKey, ok := publicKey.(*rsa.PublicKey)
+		if !ok {
+			return "", nil, errNotRSAKey
+		}
+		return value, rsaKey, nil
+	}
+
+	der, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", nil, errKeyNotFound
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return "", nil, err
+	}
+	rsaKey, ok := publicKey.(*rsa.PublicKey)
+	if !ok {
+		return "", nil, errNotRSAKey
+	}
+	keyID, _, err := fingerprintOf(rsaKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return keyID, rsaKey, nil
+}
+
+func (a *Authenticator) encryptWithPublicKey(plaintext []byte, keyID string, publicKey *rsa.PublicKey) (EncryptedData, error) {
+	aesKey := make([]byte, aesKeyLength)
+	if _, err := rand.Read(aesKey); err != nil {
+		return EncryptedData{}, err
+	}
+	data, nonce, err := encryptAES(plaintext, aesKey)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+
+	a.mu.RLock()
+	alg := a.keyWrap
+	a.mu.RUnlock()
+	wrapped, err := wrapKey(alg, publicKey, aesKey)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+	return EncryptedData{
+		Alg:   alg,
+		KeyID: keyID,
+		Data:  base64.StdEncoding.EncodeToString(data),
+		Key:   base64.StdEncoding.EncodeToString(wrapped),
+		Nonce: nonce,
+	}, nil
+}
+
+// decryptEncryptedData 解密 EncryptedData，同时返回解出的 AES 密钥
+func (a *Authenticator) decryptEncryptedData(encrypted EncryptedData) ([]byte, []byte, error) {
+	wrapped, err := base64.StdEncoding.DecodeString(encrypted.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	aesKey, err := a.decryptRSA(wrapped, encrypted.KeyID, encrypted.Alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := DecryptWithKey(encrypted, aesKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return plaintext, aesKey, nil
+}
+
+// EncryptWithKey 使用已协商的 AES 密钥加密，EncryptedData 的算法为 dir 且不带 Key
+func EncryptWithKey(plaintext []byte, aesKey []byte) (EncryptedData, error) {
+	data, nonce, err := encryptAES(plaintext, aesKey)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+	return EncryptedData{
+		Alg:   AlgDirect,
+		Data:  base64.StdEncoding.EncodeToString(data),
+		Nonce: nonce,
+	}, nil
+}
+
+// DecryptWithKey 使用已知的 AES 密钥解密 EncryptedData，忽略其中的 Key
+func DecryptWithKey(encrypted EncryptedData, aesKey []byte) ([]byte, error) {
+	data, err := base64.StdEncoding.DecodeString(encrypted.Data)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(encrypted.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	return decryptAES(data, aesKey, nonce)
+}
+
+/*****************************************************************
+*							调用方
+*****************************************************************/
+
+// EncryptRequestBody 加密请求体并设置内容类型，同时要求对方加密返回体；返回的 AES 密钥用于 DecryptResponseBody
+func (a *Authenticator) EncryptRequestBody(req *http.Request, body []byte, contentType string) ([]byte, error) {
+	aesKey := make([]byte, aesKeyLength)
+	if _, err := rand.Read(aesKey); err != nil {
+		return nil, err
+	}
+	data, nonce, err := encryptAES(body, aesKey)
+	if err != nil {
+		return nil, err
+	}
+	alg, keyID, wrapped, err := a.encryptRSA(aesKey)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := json.Marshal(EncryptedData{
+		Alg:   alg,
+		KeyID: keyID,
+		Data:  base64.StdEncoding.EncodeToString(data),
+		Key:   base64.StdEncoding.EncodeToString(wrapped),
+		Nonce: nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(encoded))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(encoded)), nil
+	}
+	req.ContentLength = int64(len(encoded))
+	req.Header.Set("Content-Type", ContentTypeEncrypted)
+	req.Header.Set(headerInnerContentType, contentType)
+	req.Header.Set("Accept", ContentTypeEncrypted)
+	return aesKey, nil
+}
+
+// DecryptResponseBody 读取并解密返回体；返回体未加密时原样返回
+func (a *Authenticator) DecryptResponseBody(resp *http.Response, aesKey []byte) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if !isEncryptedContentType(resp.Header.Get("Content-Type")) {
+		return body, nil
+	}
+
+	var encrypted EncryptedData
+	if err := json.Unmarshal(body, &encrypted); err != nil {
+		return nil, err
+	}
+	if encrypted.Alg == AlgDirect {
+		return DecryptWithKey(encrypted, aesKey)
+	}
+	plaintext, _, err := a.decryptEncryptedData(encrypted)
+	return plaintext, err
+}
+
+/*****************************************************************
+*							返回体缓冲
+*****************************************************************/
+
+// bufferedResponseWriter 缓冲处理函数写出的返回体，状态码照常记录但推迟到加密后写出
+type bufferedResponseWriter struct {
+	gin.ResponseWriter
+	body          bytes.Buffer
+	headerWritten bool
+}
+
+func (w *bufferedResponseWriter) Write(data []byte) (int, error) {
+	return w.body.Write(data)
+}
+
+func (w *bufferedResponseWriter) WriteString(s string) (int, error) {
+	return w.body.WriteString(s)
+}
+
+// WriteHeaderNow 只标记返回已提交，真正的写出在加密之后；无返回体的状态码由中间件直接透传
+func (w *bufferedResponseWriter) WriteHeaderNow() {
+	w.headerWritten = true
+}
+
+func (w *bufferedResponseWriter) Written() bool {
+	return w.headerWritten || w.body.Len() > 0
+}
+
+func (w *bufferedResponseWriter) Size() int {
+	return w.body.Len()
+}
+
+func (w *bufferedResponseWriter) Flush() {}
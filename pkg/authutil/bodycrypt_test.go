@@ -0,0 +1,104 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// serveEncrypted 以 EncryptedBody 包装 handler，外层挂上 apiutil.ErrorHandler
+func serveEncrypted(f *authtest.Fixture, handler gin.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	r := gin.New()
+	apiutil.UseErrorHandler(r)
+	r.Any("/*path", f.Server.EncryptedBody(), handler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func encryptedRequest(t *testing.T, f *authtest.Fixture, method string, body string) (*http.Request, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(method, "/orders", nil)
+	key, err := f.Client.EncryptRequestBody(req, []byte(body), "application/json")
+	if err != nil {
+		t.Fatalf("EncryptRequestBody: %v", err)
+	}
+	return req, key
+}
+
+func TestEncryptedBodyRoundTrip(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	req, key := encryptedRequest(t, f, http.MethodPost, `{"id":"42"}`)
+	w := serveEncrypted(f, func(c *gin.Context) {
+		var payload struct {
+			Id string `json:"id"`
+		}
+		if err := c.ShouldBindJSON(&payload); err != nil {
+			c.JSON(http.StatusBadRequest, apiutil.Response{Code: 4000, Message: err.Error(), Data: apiutil.EmptyResponse{}})
+			return
+		}
+		c.JSON(http.StatusCreated, apiutil.Response{Code: 2000, Message: "", Data: payload})
+	}, req)
+
+	if w.Code != http.StatusCreated || w.Header().Get("Content-Type") != authutil.ContentTypeEncrypted {
+		t.Fatalf("status = %d, content type = %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if strings.Contains(w.Body.String(), "42") {
+		t.Fatalf("response body is plaintext: %s", w.Body.String())
+	}
+	plaintext, err := f.Client.DecryptResponseBody(w.Result(), key)
+	if err != nil {
+		t.Fatalf("DecryptResponseBody: %v", err)
+	}
+	if !strings.Contains(string(plaintext), `"id":"42"`) {
+		t.Errorf("plaintext = %s", plaintext)
+	}
+}
+
+func TestEncryptedBodyPanic(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	req, _ := encryptedRequest(t, f, http.MethodPost, `{}`)
+	w := serveEncrypted(f, func(c *gin.Context) {
+		_, _ = c.Writer.WriteString("partial")
+		panic("boom")
+	}, req)
+
+	// 恢复中间件写出的 500 必须送达客户端，且不夹带缓冲中的部分返回体
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), `"code":5000`) {
+		t.Fatalf("status = %d, body = %q", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "partial") {
+		t.Errorf("buffered body leaked: %q", w.Body.String())
+	}
+}
+
+func TestEncryptedBodyWithoutBody(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	tests := []struct {
+		name    string
+		method  string
+		handler gin.HandlerFunc
+		status  int
+	}{
+		{"no content", http.MethodPost, func(c *gin.Context) { c.Status(http.StatusNoContent) }, http.StatusNoContent},
+		{"abort with status", http.MethodPost, func(c *gin.Context) { c.AbortWithStatus(http.StatusNotModified) }, http.StatusNotModified},
+		{"head", http.MethodHead, func(c *gin.Context) { c.Status(http.StatusOK) }, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := encryptedRequest(t, f, tt.method, `{}`)
+			w := serveEncrypted(f, tt.handler, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if w.Body.Len() > 0 || w.Header().Get("Content-Type") == authutil.ContentTypeEncrypted {
+				t.Errorf("body = %q, content type = %q", w.Body.String(), w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
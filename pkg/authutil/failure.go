@@ -0,0 +1,107 @@
+package authutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// 认证失败时返回体中的错误码
+const (
+	CodeAuthEmpty         = 4010 // 未携带认证信息
+	CodeAuthMalformed     = 4011 // 认证信息格式错误
+	CodeAuthUndecryptable = 4012 // 认证信息无法解密，或签名无法校验
+	CodeAuthExpired       = 4013 // 认证信息已过期
+	CodeAuthReplayed      = 4014 // 认证信息被重放
+	CodeAuthWrongAudience = 4015 // 认证信息发往其他服务
+	CodeAuthRevoked       = 4016 // 认证信息已被吊销
+	CodeAuthUnavailable   = 5031 // 认证依赖的存储不可用
+)
+
+const authScheme = "LincService"
+
+// authFailure 认证失败的分类，oauthErr 为 RFC 6750 风格的错误标识，用于 WWW-Authenticate
+type authFailure struct {
+	code     int
+	status   int
+	oauthErr string
+	message  string
+}
+
+var authFailures = []struct {
+	errs    []error
+	failure authFailure
+}{
+	{[]error{emptyAuthHeader, emptySignature, errNoPeerCertificate, emptySignedURL}, authFailure{CodeAuthEmpty, http.StatusUnauthorized, "", "Authentication required"}},
+	{[]error{invalidAuthHeader, invalidSignature, errNoServiceName, invalidToken, invalidAPIKey, invalidSession, invalidSignedURL}, authFailure{CodeAuthMalformed, http.StatusUnauthorized, "invalid_request", "Malformed credentials"}},
+	{[]error{undecryptableAuthHeader, errUntrustedPeer, unverifiedSignature, unverifiedToken, untrustedIssuer, unverifiedAPIKey, unverifiedSession, unverifiedSignedURL}, authFailure{CodeAuthUndecryptable, http.StatusUnauthorized, "invalid_token", "Credentials cannot be decrypted or verified"}},
+	{[]error{expiredAuthHeader, expiredSignature, expiredToken, expiredAPIKey, expiredSession, expiredSignedURL}, authFailure{CodeAuthExpired, http.StatusUnauthorized, "invalid_token", "Credentials have expired"}},
+	{[]error{replayedAuthHeader}, authFailure{CodeAuthReplayed, http.StatusUnauthorized, "invalid_token", "Credentials have already been used"}},
+	{[]error{wrongAudience}, authFailure{CodeAuthWrongAudience, http.StatusUnauthorized, "invalid_token", "Credentials are for another service"}},
+	{[]error{revokedAPIKey}, authFailure{CodeAuthRevoked, http.StatusUnauthorized, "invalid_token", "Credentials have been revoked"}},
+}
+
+// classifyFailure 按错误类型确定返回码；未知错误来自随机数存储等依赖，按服务不可用处理
+func classifyFailure(err error) authFailure {
+	for _, entry := range authFailures {
+		for _, target := range entry.errs {
+			if errors.Is(err, target) {
+				return entry.failure
+			}
+		}
+	}
+	return authFailure{CodeAuthUnavailable, http.StatusServiceUnavailable, "", "Authentication is temporarily unavailable"}
+}
+
+// wwwAuthenticate 生成 WWW-Authenticate 头部，未携带认证信息时只提示认证方式
+func (f authFailure) wwwAuthenticate(realm string) string {
+	value := fmt.Sprintf("%s realm=%q", authScheme, realm)
+	if len(f.oauthErr) > 0 {
+		value += fmt.Sprintf(", error=%q, error_description=%q", f.oauthErr, f.message)
+	}
+	return value
+}
+
+// AuthFailureDetail 非生产模式下返回体中附带的失败原因
+type AuthFailureDetail struct {
+	Reason string `json:"reason"`
+}
+
+// abortWithFailure 以标准返回体中止请求；生产模式下详细原因只写入日志。
+// 开发环境以外格式错误与无法解密返回同一个错误码且不附带原因，避免接收方成为 RSA1_5 填充预言机
+func (a *Authenticator) abortWithFailure(ctx *gin.Context, err error) {
+	failure := classifyFailure(err)
+	merged := false
+	if a.Profile() != ProfileDev && (failure.code == CodeAuthMalformed || failure.code == CodeAuthUndecryptable) {
+		failure = classifyFailure(undecryptableAuthHeader)
+		merged = true
+	}
+	_ = ctx.Error(err)
+	logutil.Println("[InternalServiceAuth] 认证失败：", ctx.ClientIP(), ctx.Request.Method, ctx.Request.URL.Path, err)
+
+	a.mu.RLock()
+	realm := a.service
+	a.mu.RUnlock()
+	if len(realm) == 0 {
+		realm = "internal"
+	}
+	ctx.Header("WWW-Authenticate", failure.wwwAuthenticate(realm))
+
+	var data interface{} = apiutil.EmptyResponse{}
+	if !a.isProduction() && !merged {
+		data = AuthFailureDetail{Reason: err.Error()}
+	}
+	ctx.AbortWithStatusJSON(failure.status, apiutil.Response{
+		Code:    failure.code,
+		Message: failure.message,
+		Data:    data,
+	})
+}
+
+// isProduction 运行环境为 prod 或 gin 以 release 模式运行时视为生产模式
+func (a *Authenticator) isProduction() bool {
+	return a.Profile() == ProfileProd || gin.Mode() == gin.ReleaseMode
+}
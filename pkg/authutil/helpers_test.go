@@ -0,0 +1,70 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve 用认证中间件保护一个返回调用方身份的处理函数，并发送 req
+func serve(t *testing.T, middleware gin.HandlerFunc, req *http.Request) (*httptest.ResponseRecorder, authutil.Identity) {
+	t.Helper()
+	var identity authutil.Identity
+	r := gin.New()
+	r.Any("/*path", middleware, func(c *gin.Context) {
+		identity, _ = authutil.GetIdentity(c)
+		c.JSON(http.StatusOK, apiutil.Response{Code: 2000, Message: "", Data: identity})
+	})
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w, identity
+}
+
+// newFixture 创建运行环境为 profile 的 Fixture，调用方不受环境变量影响
+func newFixture(t *testing.T, profile authutil.Profile, opts ...authtest.Option) *authtest.Fixture {
+	t.Helper()
+	t.Setenv(authutil.EnvProfile, "")
+	f := authtest.New(t, opts...)
+	if profile != authutil.ProfileUnset {
+		if err := f.Server.SetProfile(profile); err != nil {
+			t.Fatalf("SetProfile(%q): %v", profile, err)
+		}
+	}
+	return f
+}
+
+func requestWith(name string, value string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	if len(name) > 0 {
+		req.Header.Set(name, value)
+	}
+	return req
+}
+
+var (
+	peerKeyOnce    sync.Once
+	peerPrivatePEM string
+	peerPublicPEM  string
+	peerKeyErr     error
+)
+
+// peerKeys 与 authtest 的临时密钥不同的另一对密钥，模拟对端服务
+func peerKeys(t *testing.T) (string, string) {
+	t.Helper()
+	peerKeyOnce.Do(func() {
+		peerPrivatePEM, peerPublicPEM, peerKeyErr = authutil.GenerateRSAKeyPair(2048)
+	})
+	if peerKeyErr != nil {
+		t.Fatalf("GenerateRSAKeyPair: %v", peerKeyErr)
+	}
+	return peerPrivatePEM, peerPublicPEM
+}
@@ -0,0 +1,85 @@
+package authutil
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+const identityContextKey = "authutil.identity"
+
+// 身份的认证方式
+const (
+	MethodGateway   = "gateway"   // 经过 traefik 网关验证
+	MethodHeader    = "header"    // 可信访问请求头
+	MethodSignature = "signature" // 请求签名
+	MethodMTLS      = "mtls"      // 双向 TLS 的客户端证书
+	MethodJWT       = "jwt"       // Authorization 头部中的 Bearer JWT
+	MethodAPIKey    = "apikey"    // 外部客户端的 API Key
+	MethodSession   = "session"   // 会话请求头
+	MethodSignedURL = "signedurl" // 签名 URL
+	MethodDebug     = "debug"     // 调试模式放行
+	MethodBypass    = "bypass"    // 命中放行规则
+)
+
+// Identity 通过认证的调用方身份，由认证中间件写入 gin 上下文
+type Identity struct {
+	Method  string   `json:"method"`
+	Service string   `json:"service,omitempty"` // 调用方服务名称
+	UserId  string   `json:"userId,omitempty"`  // 网关传递的用户 ID
+	IsAdmin bool     `json:"isAdmin,omitempty"`
+	KeyID   string   `json:"keyId,omitempty"` // 请求签名所用的密钥 ID，或客户端证书的序列号
+	Scopes  []string `json:"scopes,omitempty"`
+}
+
+// HasScope 是否拥有指定权限范围
+func (i Identity) HasScope(scope string) bool {
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// SetIdentity 将身份写入 gin 上下文
+func SetIdentity(ctx *gin.Context, identity Identity) {
+	ctx.Set(identityContextKey, identity)
+}
+
+// GetIdentity 获取认证中间件写入的调用方身份
+func GetIdentity(ctx *gin.Context) (Identity, bool) {
+	value, ok := ctx.Get(identityContextKey)
+	if !ok {
+		return Identity{}, false
+	}
+	identity, ok := value.(Identity)
+	return identity, ok
+}
+
+// IsPrivileged 是否可以调用管理接口：请求头、请求签名和双向 TLS 认证的内部服务视为可信，
+// 网关用户和 JWT 需要管理员身份；API Key、签名 URL、会话以及放行规则和调试模式一律不能调用管理接口
+func (i Identity) IsPrivileged() bool {
+	switch i.Method {
+	case MethodHeader, MethodSignature, MethodMTLS:
+		return true
+	case MethodGateway, MethodJWT:
+		return i.IsAdmin
+	}
+	return false
+}
+
+// RequireAdmin 管理接口的授权中间件，需放在认证中间件之后；调用方不满足 IsPrivileged 时返回 403
+func RequireAdmin() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if identity, ok := GetIdentity(ctx); ok && identity.IsPrivileged() {
+			ctx.Next()
+			return
+		}
+		ctx.AbortWithStatusJSON(http.StatusForbidden, apiutil.Response{
+			Code:    4030,
+			Message: "admin privilege required",
+			Data:    apiutil.EmptyResponse{},
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"testing"
+)
+
+func TestIsPrivileged(t *testing.T) {
+	tests := []struct {
+		identity authutil.Identity
+		want     bool
+	}{
+		{authutil.Identity{Method: authutil.MethodHeader}, true},
+		{authutil.Identity{Method: authutil.MethodSignature}, true},
+		{authutil.Identity{Method: authutil.MethodMTLS}, true},
+		{authutil.Identity{Method: authutil.MethodGateway}, false},
+		{authutil.Identity{Method: authutil.MethodGateway, IsAdmin: true}, true},
+		{authutil.Identity{Method: authutil.MethodJWT}, false},
+		{authutil.Identity{Method: authutil.MethodJWT, IsAdmin: true}, true},
+		{authutil.Identity{Method: authutil.MethodAPIKey, IsAdmin: true}, false},
+		{authutil.Identity{Method: authutil.MethodSession}, false},
+		{authutil.Identity{Method: authutil.MethodSignedURL, IsAdmin: true}, false},
+		{authutil.Identity{Method: authutil.MethodBypass, IsAdmin: true}, false},
+		{authutil.Identity{Method: authutil.MethodDebug, IsAdmin: true}, false},
+		{authutil.Identity{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.identity.IsPrivileged(); got != tt.want {
+			t.Errorf("%+v.IsPrivileged() = %v, want %v", tt.identity, got, tt.want)
+		}
+	}
+}
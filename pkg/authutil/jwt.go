@@ -0,0 +1,266 @@
+package authutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	headerAuthorization = "Authorization"
+	bearerPrefix        = "Bearer "
+	defaultClockSkew    = 30 * time.Second
+)
+
+var (
+	invalidToken    = errors.New("invalid token")
+	unverifiedToken = errors.New("token signature cannot be verified")
+	expiredToken    = errors.New("token is expired or not yet valid")
+	untrustedIssuer = errors.New("token issuer is not trusted")
+)
+
+// Audience JWT 的 aud，兼容单个字符串和字符串数组两种写法
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a Audience) contains(value string) bool {
+	return containsString(a, value)
+}
+
+// Claims JWT 载荷中认证器使用的字段，时间均为 Unix 秒
+type Claims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"` // 用户 ID
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	Service   string   `json:"svc,omitempty"`   // 调用方服务名称
+	Scope     string   `json:"scope,omitempty"` // 以空格分隔的权限范围
+	Admin     bool     `json:"admin,omitempty"`
+}
+
+type jwsHeader struct {
+	Alg   string `json:"alg"`
+	Typ   string `json:"typ,omitempty"`
+	KeyID string `json:"kid,omitempty"`
+}
+
+// SetClockSkew 设置校验 JWT 的 exp 和 nbf 时容忍的时钟误差，默认为三十秒；可信请求头的过期时间最多晚于当前时间有效期加该误差
+func (a *Authenticator) SetClockSkew(skew time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.skew = skew
+}
+
+// SetTrustedIssuers 设置接受的 JWT 签发方，为空时不校验 iss；
+// 只有设置了签发方时才采信 admin 声明，未设置时任何持有受信任密钥的调用方都能自称管理员
+func (a *Authenticator) SetTrustedIssuers(issuers ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.issuers = issuers
+}
+
+// IssueToken 使用签名私钥签发 JWT；未设置的 iss、iat 和 exp 分别取本服务名称、当前时间和有效期
+func (a *Authenticator) IssueToken(claims Claims) (string, error) {
+	a.mu.RLock()
+	signer := a.signer
+	now := a.now()
+	validity, service := a.validity, a.service
+	a.mu.RUnlock()
+
+	if signer == nil {
+		return "", errors.New("signing key is not set")
+	}
+	if len(claims.Issuer) == 0 {
+		claims.Issuer = service
+	}
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = now.Unix()
+	}
+	if claims.ExpiresAt == 0 {
+		claims.ExpiresAt = now.Add(validity).Unix()
+	}
+
+	header, err := json.Marshal(jwsHeader{Alg: signer.alg, Typ: "JWT", KeyID: signer.id})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signMessage(signer.alg, signer.privateKey, []byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// VerifyToken 校验 JWT 的签名、有效期、受众和签发方，返回其中的声明；
+// 签名密钥按 kid 在密钥环中查找，不带 kid 时依次尝试全部密钥，只接受活跃和受信任的密钥；
+// 本服务设置了名称时 aud 必须存在并包含它。
+// svc 与 admin 只在能够证明时保留：签名密钥绑定了服务时 svc 必须为空或与之一致，返回绑定的名称，未绑定时清空；
+// admin 只在设置了受信任签发方、且签名密钥未绑定服务时保留
+func (a *Authenticator) VerifyToken(token string) (Claims, error) {
+	var claims Claims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("%w: want 3 segments, got %d", invalidToken, len(parts))
+	}
+	var header jwsHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return claims, err
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return claims, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, fmt.Errorf("%w: %v", invalidToken, err)
+	}
+
+	switch header.Alg {
+	case AlgRS256, AlgPS256, AlgES256, AlgEdDSA:
+	default:
+		// 包括 none 在内的其他算法一律拒绝
+		return claims, fmt.Errorf("%w: algorithm %q", unverifiedToken, header.Alg)
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	key, err := a.verifyTokenSignature(header, signingInput, signature)
+	if err != nil {
+		return claims, err
+	}
+
+	a.mu.RLock()
+	now, skew, service, issuers := a.now(), a.skew, a.service, a.issuers
+	a.mu.RUnlock()
+
+	if claims.ExpiresAt == 0 {
+		return claims, fmt.Errorf("%w: exp is missing", invalidToken)
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(skew)) {
+		return claims, fmt.Errorf("%w: expired at %s", expiredToken, time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339))
+	}
+	if claims.NotBefore != 0 && now.Add(skew).Before(time.Unix(claims.NotBefore, 0)) {
+		return claims, fmt.Errorf("%w: not valid before %s", expiredToken, time.Unix(claims.NotBefore, 0).UTC().Format(time.RFC3339))
+	}
+	if len(service) > 0 && len(claims.Audience) == 0 {
+		return claims, fmt.Errorf("%w: want %q, aud is missing", wrongAudience, service)
+	}
+	if len(service) > 0 && !claims.Audience.contains(service) {
+		return claims, fmt.Errorf("%w: want %q, got %q", wrongAudience, service, []string(claims.Audience))
+	}
+	if len(issuers) > 0 && !containsString(issuers, claims.Issuer) {
+		return claims, fmt.Errorf("%w: %q", untrustedIssuer, claims.Issuer)
+	}
+
+	// 与请求签名一致，绑定了服务名称的密钥只能以该名称签发，未绑定的密钥无法证明调用方是谁
+	if len(key.service) > 0 {
+		if len(claims.Service) > 0 && claims.Service != key.service {
+			logutil.Println("JWT 的服务名称与密钥不符：", key.id, claims.Service)
+			return claims, fmt.Errorf("%w: key %q is bound to service %q, got %q", unverifiedToken, key.id, key.service, claims.Service)
+		}
+		claims.Service = key.service
+	} else if len(claims.Service) > 0 {
+		logutil.Println("JWT 的签名密钥未绑定服务名称，忽略自报的服务名称：", key.id, claims.Service)
+		claims.Service = ""
+	}
+	// 未设置受信任签发方时无法判断签发方是否有权授予管理员，一律不采信；服务密钥签发的令牌也不能授予管理员
+	if claims.Admin && (len(issuers) == 0 || len(key.service) > 0) {
+		logutil.Println("JWT 的签发方无权授予管理员，忽略 admin 声明：", key.id, claims.Issuer)
+		claims.Admin = false
+	}
+	return claims, nil
+}
+
+// verifyTokenSignature 校验签名并返回匹配的密钥
+func (a *Authenticator) verifyTokenSignature(header jwsHeader, signingInput []byte, signature []byte) (ringKey, error) {
+	if len(header.KeyID) > 0 {
+		key, err := a.keys.verifyingKey(header.KeyID)
+		if err != nil {
+			return ringKey{}, fmt.Errorf("%w: key %q: %v", unverifiedToken, header.KeyID, err)
+		}
+		if err := verifyMessage(header.Alg, key.publicKey, signingInput, signature); err != nil {
+			return ringKey{}, fmt.Errorf("%w: key %q, %s: %v", unverifiedToken, header.KeyID, header.Alg, err)
+		}
+		return key, nil
+	}
+
+	for _, key := range a.keys.verifyingKeys() {
+		if verifyMessage(header.Alg, key.publicKey, signingInput, signature) == nil {
+			return key, nil
+		}
+	}
+	return ringKey{}, fmt.Errorf("%w: no key matches", unverifiedToken)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: %v", invalidToken, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", invalidToken, err)
+	}
+	return nil
+}
+
+// bearerToken 获取 Authorization 头部中的 Bearer 令牌
+func bearerToken(req *http.Request) (string, bool) {
+	value := req.Header.Get(headerAuthorization)
+	if len(value) <= len(bearerPrefix) || !strings.EqualFold(value[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	return strings.TrimSpace(value[len(bearerPrefix):]), true
+}
+
+// verifyBearerToken 校验 Bearer JWT 并映射为调用方身份
+func (a *Authenticator) verifyBearerToken(token string) (Identity, error) {
+	claims, err := a.VerifyToken(token)
+	if err != nil {
+		logutil.Println("JWT 校验失败：", err)
+		return Identity{}, err
+	}
+	return identityOfClaims(claims), nil
+}
+
+func identityOfClaims(claims Claims) Identity {
+	return Identity{
+		Method:  MethodJWT,
+		Service: claims.Service,
+		UserId:  claims.Subject,
+		IsAdmin: claims.Admin,
+		Scopes:  strings.Fields(claims.Scope),
+	}
+}
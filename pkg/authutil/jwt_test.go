@@ -0,0 +1,130 @@
+package authutil_test
+
+import (
+	"encoding/base64"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func bearerRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func issue(t *testing.T, issuer *authutil.Authenticator, claims authutil.Claims) string {
+	t.Helper()
+	token, err := issuer.IssueToken(claims)
+	if err != nil {
+		t.Fatalf("IssueToken: %v", err)
+	}
+	return token
+}
+
+func TestJWTAudience(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev, authtest.WithService("inventory"))
+	idp := newSigner(t, f, "idp", "")
+
+	tests := []struct {
+		name     string
+		audience authutil.Audience
+		code     int
+	}{
+		{"matching", authutil.Audience{"inventory"}, 2000},
+		{"one of several", authutil.Audience{"billing", "inventory"}, 2000},
+		{"other service", authutil.Audience{"billing"}, authutil.CodeAuthWrongAudience},
+		{"missing", nil, authutil.CodeAuthWrongAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := issue(t, idp, authutil.Claims{Subject: "42", Audience: tt.audience})
+			w, _ := serve(t, f.Middleware(), bearerRequest(token))
+			if code := authtest.ResponseCode(t, w); code != tt.code {
+				t.Errorf("code = %d, want %d, body %s", code, tt.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestJWTAdmin(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	idp := newSigner(t, f, "idp", "")
+	partner := newSigner(t, f, "partner", "")
+	service := newSigner(t, f, "billing", "billing")
+
+	// 未设置受信任签发方时不采信 admin
+	w, identity := serve(t, f.Middleware(), bearerRequest(issue(t, idp, authutil.Claims{Subject: "42", Admin: true})))
+	if w.Code != http.StatusOK || identity.IsAdmin || identity.IsPrivileged() {
+		t.Errorf("no trusted issuers: status = %d, identity = %+v", w.Code, identity)
+	}
+
+	f.Server.SetTrustedIssuers("idp")
+	w, identity = serve(t, f.Middleware(), bearerRequest(issue(t, idp, authutil.Claims{Subject: "42", Admin: true})))
+	if w.Code != http.StatusOK || !identity.IsAdmin || identity.UserId != "42" {
+		t.Errorf("trusted issuer: status = %d, identity = %+v", w.Code, identity)
+	}
+
+	// 其他签发方的令牌直接拒绝
+	w, _ = serve(t, f.Middleware(), bearerRequest(issue(t, partner, authutil.Claims{Subject: "42", Admin: true})))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("untrusted issuer: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+
+	// 服务密钥即使自称受信任的签发方也不能授予管理员
+	w, identity = serve(t, f.Middleware(), bearerRequest(issue(t, service, authutil.Claims{Issuer: "idp", Subject: "42", Admin: true})))
+	if w.Code != http.StatusOK || identity.IsAdmin {
+		t.Errorf("service key: status = %d, identity = %+v", w.Code, identity)
+	}
+}
+
+func TestJWTServiceBinding(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	bound := newSigner(t, f, "billing", "billing")
+	unbound := newSigner(t, f, "partner", "")
+
+	w, identity := serve(t, f.Middleware(), bearerRequest(issue(t, bound, authutil.Claims{})))
+	if w.Code != http.StatusOK || identity.Method != authutil.MethodJWT || identity.Service != "billing" {
+		t.Errorf("bound key without svc: status = %d, identity = %+v", w.Code, identity)
+	}
+	w, _ = serve(t, f.Middleware(), bearerRequest(issue(t, bound, authutil.Claims{Service: "payments"})))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("bound key with another svc: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+
+	// 未绑定的密钥自报的服务名称不被采信
+	w, identity = serve(t, f.Middleware(), bearerRequest(issue(t, unbound, authutil.Claims{Service: "billing"})))
+	if w.Code != http.StatusOK || identity.Service != "" {
+		t.Errorf("unbound key: status = %d, identity = %+v", w.Code, identity)
+	}
+}
+
+func TestJWTRejected(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	idp := newSigner(t, f, "idp", "")
+
+	expired := issue(t, idp, authutil.Claims{Subject: "42", ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+	w, _ := serve(t, f.Middleware(), bearerRequest(expired))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthExpired {
+		t.Errorf("expired: code = %d, want %d", code, authutil.CodeAuthExpired)
+	}
+
+	// alg 为 none 的令牌即使去掉签名也不能通过
+	parts := strings.Split(issue(t, idp, authutil.Claims{Subject: "42"}), ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + "."
+	w, _ = serve(t, f.Middleware(), bearerRequest(none))
+	if w.Code == http.StatusOK {
+		t.Error("alg none accepted")
+	}
+
+	// 篡改载荷后签名失效
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1","exp":9999999999}`)) + "." + parts[2]
+	w, _ = serve(t, f.Middleware(), bearerRequest(forged))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("forged payload: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+}
@@ -0,0 +1,360 @@
+package authutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/datautil"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	keyDirName            = "keys"
+	publicKeyFileName     = "public.pem"
+	privateKeyFileName    = "private.pem"
+	defaultWatchInterval  = 5 * time.Second // 检查密钥文件变化的间隔
+	keyFileStatusOK       = "ok"            // 最近一次加载成功
+	keyFileStatusDegraded = "degraded"      // 最近一次重新加载失败，仍在使用之前的密钥
+	keyFileStatusDown     = "unavailable"   // 从未加载成功
+)
+
+var errInsecureKeyFile = errors.New("key file permissions are too open")
+
+// KeyFiles 密钥文件路径，路径为空表示不加载该文件
+type KeyFiles struct {
+	PublicKey  string `json:"publicKey"`  // 用于加密的公钥
+	PrivateKey string `json:"privateKey"` // 用于解密的私钥
+}
+
+// DefaultKeyFiles 数据目录下 keys 文件夹中的 public.pem 和 private.pem
+func DefaultKeyFiles() KeyFiles {
+	dir := filepath.Join(datautil.GetRelDataPath(), keyDirName)
+	return KeyFiles{
+		PublicKey:  filepath.Join(dir, publicKeyFileName),
+		PrivateKey: filepath.Join(dir, privateKeyFileName),
+	}
+}
+
+// KeyFileStatus 密钥文件的加载状态，用于健康检查
+type KeyFileStatus struct {
+	Status     string   `json:"status"`
+	Files      KeyFiles `json:"files"`
+	KeyIDs     []string `json:"keyIds"`     // 当前由文件加载的密钥
+	Reloads    int      `json:"reloads"`    // 加载成功的次数
+	Failures   int      `json:"failures"`   // 加载失败的次数
+	LoadedAt   int64    `json:"loadedAt"`   // 最近一次加载成功的时间，UTC时间戳
+	LastError  string   `json:"lastError"`  // 最近一次加载失败的原因，成功后清空
+	CheckedAt  int64    `json:"checkedAt"`  // 最近一次检查文件的时间，UTC时间戳
+	Watching   bool     `json:"watching"`   // 是否在监视文件变化
+	IntervalMs int64    `json:"intervalMs"` // 监视间隔
+}
+
+// keyFileLoader 记录由文件加载的密钥，重新加载时上一批密钥转为退役中，更早的一批被移除
+type keyFileLoader struct {
+	mu       sync.Mutex
+	files    KeyFiles
+	current  []string
+	previous []string
+	stamps   map[string]fileStamp
+	status   KeyFileStatus
+	stop     chan struct{}
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+}
+
+// checkKeyFilePermissions 私钥文件不能被其他用户读写，公钥文件不能被其他用户写入；Windows 上不检查
+func checkKeyFilePermissions(path string, private bool) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if runtime.GOOS == "windows" {
+		return info, nil
+	}
+	mode := info.Mode().Perm()
+	if private && mode&0o077 != 0 {
+		return nil, fmt.Errorf("%w: %s has mode %#o, want 0600", errInsecureKeyFile, path, mode)
+	}
+	if !private && mode&0o022 != 0 {
+		return nil, fmt.Errorf("%w: %s has mode %#o, must not be writable by others", errInsecureKeyFile, path, mode)
+	}
+	return info, nil
+}
+
+// readKeyFiles 读取并解析密钥文件，全部成功后才返回，供一次性替换
+func readKeyFiles(files KeyFiles) ([]keyEntry, int, error) {
+	var entries []keyEntry
+	activate := -1
+
+	read := func(path string, private bool) ([]byte, error) {
+		if _, err := checkKeyFilePermissions(path, private); err != nil {
+			return nil, err
+		}
+		return os.ReadFile(path)
+	}
+
+	if len(files.PrivateKey) > 0 {
+		data, err := read(files.PrivateKey, true)
+		if err != nil {
+			return nil, 0, err
+		}
+		privateKey, err := parseRSAPrivateKeyPEM(string(data))
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", files.PrivateKey, err)
+		}
+		entries = append(entries, keyEntry{publicKey: &privateKey.PublicKey, privateKey: privateKey})
+		activate = len(entries) - 1
+	}
+	if len(files.PublicKey) > 0 {
+		data, err := read(files.PublicKey, false)
+		if err != nil {
+			return nil, 0, err
+		}
+		publicKey, err := parseRSAPublicKeyPEM(string(data))
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", files.PublicKey, err)
+		}
+		entries = append(entries, keyEntry{publicKey: publicKey})
+		activate = len(entries) - 1
+	}
+	if len(entries) == 0 {
+		return nil, 0, errors.New("no key file configured")
+	}
+	return entries, activate, nil
+}
+
+// stampKeyFiles 记录文件当前的修改时间、大小和权限，不存在的文件不记录
+func stampKeyFiles(files KeyFiles) map[string]fileStamp {
+	stamps := make(map[string]fileStamp)
+	for _, path := range []string{files.PublicKey, files.PrivateKey} {
+		if len(path) == 0 {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+		}
+	}
+	return stamps
+}
+
+// LoadKeyFiles 从文件加载公钥和私钥并替换之前由文件加载的密钥；公钥成为活跃密钥，未配置公钥时私钥成为活跃密钥。
+// 加载失败时保留原有密钥
+func (a *Authenticator) LoadKeyFiles(files KeyFiles) error {
+	a.mu.Lock()
+	if a.keyFiles == nil {
+		a.keyFiles = &keyFileLoader{}
+	}
+	loader := a.keyFiles
+	a.mu.Unlock()
+
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	loader.files = files
+	return a.reloadLocked(loader)
+}
+
+func (a *Authenticator) reloadLocked(loader *keyFileLoader) error {
+	now := a.currentTime()
+	loader.status.Files = loader.files
+	loader.status.CheckedAt = now.UnixMilli()
+	// 读取之前记录文件状态，读取期间文件再次变化时下一次检查会重新加载；
+	// 只有加载成功才保存，失败后每次检查都会重试，例如修正权限或写完分两步写入的文件之后
+	stamps := stampKeyFiles(loader.files)
+
+	entries, activate, err := readKeyFiles(loader.files)
+	if err == nil {
+		var ids []string
+		ids, err = a.keys.swap(entries, activate, loader.previous, now)
+		if err == nil {
+			for _, id := range loader.previous {
+				if !containsString(ids, id) {
+					a.sessions.purgeKey(id)
+				}
+			}
+			// 之前的一批密钥仍可解密旧请求，直到下一次重新加载
+			for _, id := range loader.current {
+				if !containsString(ids, id) {
+					_ = a.keys.setState(id, KeyStateRetiring)
+				}
+			}
+			loader.previous, loader.current = loader.current, ids
+			loader.stamps = stamps
+			loader.status.KeyIDs = uniqueStrings(ids)
+			loader.status.Reloads++
+			loader.status.LoadedAt = now.UnixMilli()
+			loader.status.LastError = ""
+			loader.status.Status = keyFileStatusOK
+			logutil.Println("密钥文件加载成功：", loader.status.KeyIDs)
+			return nil
+		}
+	}
+
+	loader.status.Failures++
+	loader.status.LastError = err.Error()
+	if loader.status.Reloads > 0 {
+		loader.status.Status = keyFileStatusDegraded
+	} else {
+		loader.status.Status = keyFileStatusDown
+	}
+	logutil.Errorf("密钥文件加载失败，继续使用原有密钥：%v", err)
+	return err
+}
+
+func uniqueStrings(values []string) []string {
+	var unique []string
+	for _, value := range values {
+		if !containsString(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+// changed 文件的修改时间、大小或权限发生变化
+func (loader *keyFileLoader) changed() bool {
+	for _, path := range []string{loader.files.PublicKey, loader.files.PrivateKey} {
+		if len(path) == 0 {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			// 文件暂时不存在时（例如正在被替换）不视为变化，等待下一次检查
+			continue
+		}
+		stamp, ok := loader.stamps[path]
+		if !ok || !stamp.modTime.Equal(info.ModTime()) || stamp.size != info.Size() || stamp.mode != info.Mode() {
+			return true
+		}
+	}
+	return false
+}
+
+// WatchKeyFiles 加载密钥文件，并每隔 interval 检查一次，文件变化时重新加载；
+// 首次加载失败也会继续监视，以便文件就绪后自动生效
+func (a *Authenticator) WatchKeyFiles(files KeyFiles, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	err := a.LoadKeyFiles(files)
+
+	a.mu.RLock()
+	loader := a.keyFiles
+	a.mu.RUnlock()
+
+	loader.mu.Lock()
+	if loader.stop != nil {
+		close(loader.stop)
+	}
+	stop := make(chan struct{})
+	loader.stop = stop
+	loader.status.Watching = true
+	loader.status.IntervalMs = interval.Milliseconds()
+	loader.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				loader.mu.Lock()
+				loader.status.CheckedAt = a.currentTime().UnixMilli()
+				if loader.changed() {
+					logutil.Println("密钥文件发生变化，重新加载")
+					_ = a.reloadLocked(loader)
+				}
+				loader.mu.Unlock()
+			}
+		}
+	}()
+	return err
+}
+
+// StopWatchingKeyFiles 停止监视密钥文件，已加载的密钥保持不变
+func (a *Authenticator) StopWatchingKeyFiles() {
+	a.mu.RLock()
+	loader := a.keyFiles
+	a.mu.RUnlock()
+	if loader == nil {
+		return
+	}
+
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	if loader.stop != nil {
+		close(loader.stop)
+		loader.stop = nil
+	}
+	loader.status.Watching = false
+}
+
+// KeyFileStatus 获取密钥文件的加载状态，未从文件加载过密钥时返回 false
+func (a *Authenticator) KeyFileStatus() (KeyFileStatus, bool) {
+	a.mu.RLock()
+	loader := a.keyFiles
+	a.mu.RUnlock()
+	if loader == nil {
+		return KeyFileStatus{}, false
+	}
+
+	loader.mu.Lock()
+	defer loader.mu.Unlock()
+	status := loader.status
+	status.KeyIDs = append([]string(nil), loader.status.KeyIDs...)
+	return status, true
+}
+
+// HealthFunc 健康检查接口；能够加密和解密时返回 200，密钥文件最近一次重新加载失败时 status 为 degraded
+func (a *Authenticator) HealthFunc(c *gin.Context) {
+	health := gin.H{
+		"status": keyFileStatusOK,
+		"auth":   a.Stats(),
+	}
+
+	ready := a.canEncrypt() && a.canDecrypt()
+	if status, ok := a.KeyFileStatus(); ok {
+		health["keyFiles"] = status
+		if status.Status != keyFileStatusOK {
+			health["status"] = status.Status
+		}
+	}
+	if !ready {
+		health["status"] = keyFileStatusDown
+		c.JSON(http.StatusServiceUnavailable, apiutil.Response{
+			Code:    5030,
+			Message: "auth keys are not ready",
+			Data:    health,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    health,
+	})
+}
+
+func (a *Authenticator) canEncrypt() bool {
+	_, _, err := a.keys.active()
+	return err == nil
+}
+
+func (a *Authenticator) canDecrypt() bool {
+	_, err := a.keys.privateKeys("")
+	return err == nil
+}
@@ -0,0 +1,120 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// keyFilesIn 在临时目录中写入密钥文件，privateMode 为私钥文件的权限
+func keyFilesIn(t *testing.T, privatePEM string, privateMode os.FileMode) authutil.KeyFiles {
+	t.Helper()
+	dir := t.TempDir()
+	files := authutil.KeyFiles{PrivateKey: filepath.Join(dir, "private.pem")}
+	if err := os.WriteFile(files.PrivateKey, []byte(privatePEM), privateMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(files.PrivateKey, privateMode); err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// waitForKeyFileStatus 等待密钥文件的加载状态变为 status
+func waitForKeyFileStatus(t *testing.T, a *authutil.Authenticator, status string) authutil.KeyFileStatus {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		current, _ := a.KeyFileStatus()
+		if current.Status == status {
+			return current
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("key file status = %+v, want %s", current, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLoadKeyFilesRejectsOpenPermissions(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	a := authutil.NewAuthenticator()
+	files := keyFilesIn(t, f.PrivateKeyPEM, 0644)
+
+	if err := a.WatchKeyFiles(files, 10*time.Millisecond); err == nil || !strings.Contains(err.Error(), "permissions") {
+		t.Fatalf("WatchKeyFiles with 0644 private key: err = %v", err)
+	}
+	defer a.StopWatchingKeyFiles()
+
+	if err := os.Chmod(files.PrivateKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	status := waitForKeyFileStatus(t, a, "ok")
+	if len(status.KeyIDs) != 1 || status.KeyIDs[0] != f.KeyID || status.Failures == 0 {
+		t.Errorf("status = %+v", status)
+	}
+}
+
+func TestWatchKeyFilesRetriesFailedLoad(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	a := authutil.NewAuthenticator()
+
+	// 第一步写入的内容无法解析，第二步写入完整内容，大小和修改时间都与第一步相同
+	partial := strings.Repeat("-", len(f.PrivateKeyPEM))
+	files := keyFilesIn(t, partial, 0600)
+	info, err := os.Stat(files.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.WatchKeyFiles(files, 10*time.Millisecond); err == nil {
+		t.Fatal("WatchKeyFiles with a partial file succeeded")
+	}
+	defer a.StopWatchingKeyFiles()
+	waitForKeyFileStatus(t, a, "unavailable")
+
+	if err := os.WriteFile(files.PrivateKey, []byte(f.PrivateKeyPEM), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(files.PrivateKey, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	waitForKeyFileStatus(t, a, "ok")
+
+	if w, _ := serve(t, a.Middleware(), requestWith(f.ValidHeader(""))); w.Code != http.StatusOK {
+		t.Errorf("header rejected after reload: %s", w.Body.String())
+	}
+}
+
+func TestReloadKeepsPreviousKeyRetiring(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	peerPrivate, peerPublic := peerKeys(t)
+	a := authutil.NewAuthenticator()
+	files := keyFilesIn(t, f.PrivateKeyPEM, 0600)
+	if err := a.LoadKeyFiles(files); err != nil {
+		t.Fatalf("LoadKeyFiles: %v", err)
+	}
+
+	if err := os.WriteFile(files.PrivateKey, []byte(peerPrivate), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.LoadKeyFiles(files); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	// 上一批密钥转为退役中，仍可解密尚未切换的调用方的请求
+	if w, _ := serve(t, a.Middleware(), requestWith(f.ValidHeader(""))); w.Code != http.StatusOK {
+		t.Errorf("previous key rejected: %s", w.Body.String())
+	}
+	switched := authutil.NewAuthenticator()
+	if err := switched.SetPublicKey(peerPublic); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := serve(t, a.Middleware(), requestWith(switched.GenerateAuthHeaderValue())); w.Code != http.StatusOK {
+		t.Errorf("new key rejected: %s", w.Body.String())
+	}
+}
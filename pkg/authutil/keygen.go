@@ -0,0 +1,131 @@
+package authutil
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const defaultRSAKeyBits = 3072
+
+var errKeyPairMismatch = errors.New("public key does not match private key")
+
+// GenerateRSAKeyPair 生成 RSA 密钥对，私钥为 PKCS#1 格式，公钥为 PKIX 格式；bits 不大于 0 时使用 3072
+func GenerateRSAKeyPair(bits int) (string, string, error) {
+	if bits <= 0 {
+		bits = defaultRSAKeyBits
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return "", "", err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	return string(privatePEM), string(publicPEM), nil
+}
+
+// WriteKeyFiles 写入密钥文件：目录权限 0700，私钥 0600，公钥 0644；overwrite 为 false 时文件已存在则返回错误
+func WriteKeyFiles(files KeyFiles, privatePEM string, publicPEM string, overwrite bool) error {
+	if !overwrite {
+		for _, path := range []string{files.PrivateKey, files.PublicKey} {
+			if len(path) == 0 {
+				continue
+			}
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("%s already exists", path)
+			}
+		}
+	}
+
+	if len(files.PrivateKey) > 0 {
+		if err := writeFileAtomic(files.PrivateKey, []byte(privatePEM), 0600); err != nil {
+			return err
+		}
+	}
+	if len(files.PublicKey) > 0 {
+		if err := writeFileAtomic(files.PublicKey, []byte(publicPEM), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic 先写入同目录下的临时文件再重命名，监视密钥文件的服务不会读到写了一半的内容
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// InspectKeyPEM 解析公钥或私钥 PEM，返回密钥 ID、指纹和签名算法
+func InspectKeyPEM(pemStr string) (KeyInfo, error) {
+	info := KeyInfo{}
+
+	var publicKey interface{}
+	if privateKey, err := parsePrivateKeyPEM(pemStr); err == nil {
+		publicKey = privateKey.Public()
+		info.HasPrivateKey = true
+	} else {
+		publicKey, err = parsePublicKeyPEM(pemStr)
+		if err != nil {
+			return info, err
+		}
+	}
+
+	id, fingerprint, err := fingerprintOf(publicKey)
+	if err != nil {
+		return info, err
+	}
+	info.ID = id
+	info.Fingerprint = fingerprint
+	info.Algorithm, _ = defaultSignatureAlgorithm(publicKey)
+	return info, nil
+}
+
+// CheckKeyPair 检查公钥与私钥是否属于同一密钥对
+func CheckKeyPair(publicPEM string, privatePEM string) error {
+	publicInfo, err := InspectKeyPEM(publicPEM)
+	if err != nil {
+		return err
+	}
+	privateInfo, err := InspectKeyPEM(privatePEM)
+	if err != nil {
+		return err
+	}
+	if !privateInfo.HasPrivateKey {
+		return errNoPrivateKey
+	}
+	if publicInfo.Fingerprint != privateInfo.Fingerprint {
+		return fmt.Errorf("%w: %s != %s", errKeyPairMismatch, publicInfo.ID, privateInfo.ID)
+	}
+	return nil
+}
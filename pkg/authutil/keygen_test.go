@@ -0,0 +1,72 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteKeyFiles(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	dir := filepath.Join(t.TempDir(), "keys")
+	files := authutil.KeyFiles{
+		PublicKey:  filepath.Join(dir, "public.pem"),
+		PrivateKey: filepath.Join(dir, "private.pem"),
+	}
+
+	if err := authutil.WriteKeyFiles(files, f.PrivateKeyPEM, f.PublicKeyPEM, false); err != nil {
+		t.Fatalf("WriteKeyFiles: %v", err)
+	}
+	for path, want := range map[string]os.FileMode{dir: 0700, files.PrivateKey: 0600, files.PublicKey: 0644} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s mode = %#o, want %#o", path, got, want)
+		}
+	}
+
+	// 写入的文件可以直接通过加载时的权限检查
+	a := authutil.NewAuthenticator()
+	if err := a.LoadKeyFiles(files); err != nil {
+		t.Errorf("LoadKeyFiles: %v", err)
+	}
+
+	peerPrivate, peerPublic := peerKeys(t)
+	if err := authutil.WriteKeyFiles(files, peerPrivate, peerPublic, false); err == nil {
+		t.Error("existing files overwritten without overwrite")
+	}
+	if err := authutil.WriteKeyFiles(files, peerPrivate, peerPublic, true); err != nil {
+		t.Errorf("WriteKeyFiles with overwrite: %v", err)
+	}
+}
+
+func TestInspectAndCheckKeyPair(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	_, peerPublic := peerKeys(t)
+
+	private, err := authutil.InspectKeyPEM(f.PrivateKeyPEM)
+	if err != nil {
+		t.Fatalf("InspectKeyPEM(private): %v", err)
+	}
+	public, err := authutil.InspectKeyPEM(f.PublicKeyPEM)
+	if err != nil {
+		t.Fatalf("InspectKeyPEM(public): %v", err)
+	}
+	// 密钥 ID 与认证器中看到的一致，运维可以据此核对
+	if private.ID != f.KeyID || public.ID != f.KeyID || !private.HasPrivateKey || public.HasPrivateKey || private.Algorithm != authutil.AlgPS256 {
+		t.Errorf("private = %+v, public = %+v, key ID %s", private, public, f.KeyID)
+	}
+
+	if err := authutil.CheckKeyPair(f.PublicKeyPEM, f.PrivateKeyPEM); err != nil {
+		t.Errorf("CheckKeyPair(matching): %v", err)
+	}
+	if err := authutil.CheckKeyPair(peerPublic, f.PrivateKeyPEM); err == nil {
+		t.Error("CheckKeyPair accepted keys from different pairs")
+	}
+	if err := authutil.CheckKeyPair(f.PublicKeyPEM, f.PublicKeyPEM); err == nil {
+		t.Error("CheckKeyPair accepted a public key as the private key")
+	}
+}
@@ -0,0 +1,336 @@
+package authutil
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// KeyState 密钥状态
+type KeyState string
+
+const (
+	KeyStateActive   KeyState = "active"   // 当前用于加密，同时可用于解密
+	KeyStateRetiring KeyState = "retiring" // 仅用于解密，等待所有调用方切换后移除
+	KeyStateTrusted  KeyState = "trusted"  // 调用方的公钥，仅用于校验请求签名
+)
+
+var (
+	errKeyNotFound     = errors.New("key not found")
+	errNoActiveKey     = errors.New("public key is not set")
+	errNoPrivateKey    = errors.New("private key is not set")
+	errInvalidKeyState = errors.New("invalid key state")
+	errKeyNotUsable    = errors.New("key is retiring and cannot verify signatures")
+)
+
+// KeyInfo 密钥信息，用于展示轮换状态，不包含密钥本身
+type KeyInfo struct {
+	ID            string   `json:"id"`
+	State         KeyState `json:"state"`
+	Algorithm     string   `json:"algorithm"`   // 签名时使用的算法，也反映了密钥类型
+	Fingerprint   string   `json:"fingerprint"` // 公钥 DER 的 SHA-256
+	HasPrivateKey bool     `json:"hasPrivateKey"`
+	Service       string   `json:"service,omitempty"` // 绑定的调用方服务名称
+	AddedAt       int64    `json:"addedAt"`           // 添加时间，UTC时间戳
+}
+
+type ringKey struct {
+	id          string
+	fingerprint string
+	state       KeyState
+	publicKey   crypto.PublicKey
+	privateKey  crypto.Signer
+	service     string // 绑定的调用方服务名称，签名中的服务名称必须与之一致
+	addedAt     time.Time
+}
+
+// keyRing 按密钥 ID 保存多把密钥，活跃密钥用于加密，活跃和退役中的密钥都可用于解密
+type keyRing struct {
+	mu       sync.RWMutex
+	keys     map[string]*ringKey
+	activeID string
+}
+
+func newKeyRing() *keyRing {
+	return &keyRing{keys: make(map[string]*ringKey)}
+}
+
+// fingerprintOf 计算公钥指纹，密钥 ID 取指纹的前 16 位
+func fingerprintOf(publicKey crypto.PublicKey) (string, string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256(der)
+	fingerprint := hex.EncodeToString(sum[:])
+	return fingerprint[:16], fingerprint, nil
+}
+
+// add 添加或合并密钥，同一公钥的公钥和私钥合并为同一条；activate 为 true 时设为活跃密钥，原活跃密钥转为退役中
+func (r *keyRing) add(publicKey crypto.PublicKey, privateKey crypto.Signer, activate bool, now time.Time) (string, error) {
+	id, fingerprint, err := fingerprintOf(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		key = &ringKey{
+			id:          id,
+			fingerprint: fingerprint,
+			state:       KeyStateRetiring,
+			publicKey:   publicKey,
+			addedAt:     now,
+		}
+		r.keys[id] = key
+	}
+	if privateKey != nil {
+		key.privateKey = privateKey
+	}
+	if activate || len(r.activeID) == 0 {
+		r.activateLocked(id)
+	}
+	return id, nil
+}
+
+// keyEntry 待批量加入密钥环的密钥，privateKey 可以为空
+type keyEntry struct {
+	publicKey  crypto.PublicKey
+	privateKey crypto.Signer
+}
+
+// swap 在一次加锁中移除 stale 中的密钥、加入 entries 并把 entries[activate] 设为活跃密钥，
+// 读取方不会看到只完成一半的替换；返回 entries 对应的密钥 ID
+func (r *keyRing) swap(entries []keyEntry, activate int, stale []string, now time.Time) ([]string, error) {
+	ids := make([]string, len(entries))
+	fingerprints := make([]string, len(entries))
+	for i, entry := range entries {
+		id, fingerprint, err := fingerprintOf(entry.publicKey)
+		if err != nil {
+			return nil, err
+		}
+		ids[i], fingerprints[i] = id, fingerprint
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range stale {
+		if containsString(ids, id) {
+			continue
+		}
+		delete(r.keys, id)
+		if r.activeID == id {
+			r.activeID = ""
+		}
+	}
+	for i, entry := range entries {
+		key, ok := r.keys[ids[i]]
+		if !ok {
+			key = &ringKey{
+				id:          ids[i],
+				fingerprint: fingerprints[i],
+				state:       KeyStateRetiring,
+				publicKey:   entry.publicKey,
+				addedAt:     now,
+			}
+			r.keys[ids[i]] = key
+		}
+		if entry.privateKey != nil {
+			key.privateKey = entry.privateKey
+		}
+	}
+	if activate >= 0 && activate < len(ids) {
+		r.activateLocked(ids[activate])
+	}
+	return ids, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *keyRing) activateLocked(id string) {
+	if previous, ok := r.keys[r.activeID]; ok && r.activeID != id {
+		previous.state = KeyStateRetiring
+	}
+	r.keys[id].state = KeyStateActive
+	r.activeID = id
+}
+
+func (r *keyRing) setState(id string, state KeyState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return errKeyNotFound
+	}
+	switch state {
+	case KeyStateActive:
+		r.activateLocked(id)
+	case KeyStateRetiring, KeyStateTrusted:
+		key.state = state
+		if r.activeID == id {
+			r.activeID = ""
+		}
+	default:
+		return errInvalidKeyState
+	}
+	return nil
+}
+
+func (r *keyRing) remove(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.keys[id]; !ok {
+		return errKeyNotFound
+	}
+	delete(r.keys, id)
+	if r.activeID == id {
+		r.activeID = ""
+	}
+	return nil
+}
+
+// active 获取活跃密钥的 ID 和公钥
+func (r *keyRing) active() (string, *rsa.PublicKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[r.activeID]
+	if !ok {
+		return "", nil, errNoActiveKey
+	}
+	publicKey, ok := key.publicKey.(*rsa.PublicKey)
+	if !ok {
+		return "", nil, errNotRSAKey
+	}
+	return key.id, publicKey, nil
+}
+
+// publicKey 获取密钥 ID 对应的公钥，用于校验签名
+func (r *keyRing) publicKey(id string) (crypto.PublicKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, errKeyNotFound
+	}
+	return key.publicKey, nil
+}
+
+// verifyingKey 获取用于校验签名的密钥，只有活跃和受信任的密钥可用，退役中的密钥只能用于解密
+func (r *keyRing) verifyingKey(id string) (ringKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return ringKey{}, errKeyNotFound
+	}
+	if key.state != KeyStateActive && key.state != KeyStateTrusted {
+		return ringKey{}, errKeyNotUsable
+	}
+	return *key, nil
+}
+
+// bind 把密钥绑定到调用方服务名称
+func (r *keyRing) bind(id string, service string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok {
+		return errKeyNotFound
+	}
+	key.service = service
+	return nil
+}
+
+// verifyingKeys 获取全部可用于校验签名的密钥，即活跃和受信任的密钥
+func (r *keyRing) verifyingKeys() []ringKey {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	keys := make([]ringKey, 0, len(r.keys))
+	for _, key := range r.keys {
+		if key.state == KeyStateActive || key.state == KeyStateTrusted {
+			keys = append(keys, *key)
+		}
+	}
+	return keys
+}
+
+// privateKeys 获取用于解密的 RSA 私钥；id 为空时返回全部私钥，活跃密钥排在最前
+func (r *keyRing) privateKeys(id string) ([]*rsa.PrivateKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if len(id) > 0 {
+		key, ok := r.keys[id]
+		if !ok {
+			return nil, errNoPrivateKey
+		}
+		privateKey, ok := key.privateKey.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errNoPrivateKey
+		}
+		return []*rsa.PrivateKey{privateKey}, nil
+	}
+
+	var keys []*rsa.PrivateKey
+	if key, ok := r.keys[r.activeID]; ok {
+		if privateKey, ok := key.privateKey.(*rsa.PrivateKey); ok {
+			keys = append(keys, privateKey)
+		}
+	}
+	for _, key := range r.keys {
+		if privateKey, ok := key.privateKey.(*rsa.PrivateKey); ok && key.id != r.activeID {
+			keys = append(keys, privateKey)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errNoPrivateKey
+	}
+	return keys, nil
+}
+
+func (r *keyRing) list() []KeyInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	infos := make([]KeyInfo, 0, len(r.keys))
+	for _, key := range r.keys {
+		alg, _ := defaultSignatureAlgorithm(key.publicKey)
+		infos = append(infos, KeyInfo{
+			ID:            key.id,
+			State:         key.state,
+			Algorithm:     alg,
+			Fingerprint:   key.fingerprint,
+			HasPrivateKey: key.privateKey != nil,
+			Service:       key.service,
+			AddedAt:       key.addedAt.UnixMilli(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].AddedAt < infos[j].AddedAt
+	})
+	return infos
+}
@@ -0,0 +1,135 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"testing"
+)
+
+func activeKeyOf(t *testing.T, a *authutil.Authenticator) authutil.KeyInfo {
+	t.Helper()
+	for _, key := range a.Keys() {
+		if key.State == authutil.KeyStateActive {
+			return key
+		}
+	}
+	t.Fatal("no active key")
+	return authutil.KeyInfo{}
+}
+
+func TestSetKeysFromDifferentPairs(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	peerPrivate, peerPublic := peerKeys(t)
+
+	peer := authutil.NewAuthenticator()
+	if err := peer.SetPrivateKey(peerPrivate); err != nil {
+		t.Fatalf("SetPrivateKey: %v", err)
+	}
+
+	orders := map[string][]func(a *authutil.Authenticator) error{
+		"public first": {
+			func(a *authutil.Authenticator) error { return a.SetPublicKey(peerPublic) },
+			func(a *authutil.Authenticator) error { return a.SetPrivateKey(f.PrivateKeyPEM) },
+		},
+		"private first": {
+			func(a *authutil.Authenticator) error { return a.SetPrivateKey(f.PrivateKeyPEM) },
+			func(a *authutil.Authenticator) error { return a.SetPublicKey(peerPublic) },
+		},
+	}
+	for name, steps := range orders {
+		t.Run(name, func(t *testing.T) {
+			a := authutil.NewAuthenticator()
+			for _, step := range steps {
+				if err := step(a); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// 发出的请求头用对端公钥加密，对端可以校验
+			if w, _ := serve(t, peer.Middleware(), requestWith(a.GenerateAuthHeaderValue())); w.Code != http.StatusOK {
+				t.Errorf("peer rejected outgoing header: %s", w.Body.String())
+			}
+			// 用自己公钥加密的请求仍然可以解密
+			if w, _ := serve(t, a.Middleware(), requestWith(f.ValidHeader(""))); w.Code != http.StatusOK {
+				t.Errorf("incoming header rejected: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSetPrivateKeyActivatesFirstKey(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	a := authutil.NewAuthenticator()
+	if err := a.SetPrivateKey(f.PrivateKeyPEM); err != nil {
+		t.Fatalf("SetPrivateKey: %v", err)
+	}
+	if key := activeKeyOf(t, a); key.ID != f.KeyID || !key.HasPrivateKey {
+		t.Errorf("active key = %+v, want %s with private key", key, f.KeyID)
+	}
+
+	// 之后添加的私钥只用于解密，不替换活跃密钥
+	peerPrivate, _ := peerKeys(t)
+	if err := a.SetPrivateKey(peerPrivate); err != nil {
+		t.Fatalf("SetPrivateKey: %v", err)
+	}
+	if key := activeKeyOf(t, a); key.ID != f.KeyID {
+		t.Errorf("active key = %s, want %s", key.ID, f.KeyID)
+	}
+	if len(a.Keys()) != 2 {
+		t.Errorf("keys = %+v", a.Keys())
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	f.Client.SetLegacyAuthHeader(false)
+	peerPrivate, peerPublic := peerKeys(t)
+
+	newID, err := f.Server.AddKey(peerPrivate, authutil.KeyStateActive)
+	if err != nil {
+		t.Fatalf("AddKey: %v", err)
+	}
+	states := map[string]authutil.KeyState{}
+	for _, key := range f.Server.Keys() {
+		states[key.ID] = key.State
+	}
+	if states[newID] != authutil.KeyStateActive || states[f.KeyID] != authutil.KeyStateRetiring {
+		t.Fatalf("states = %v", states)
+	}
+
+	// 尚未切换的调用方仍使用旧公钥，退役中的密钥可以解密
+	if w, _ := serve(t, f.Middleware(), requestWith(f.ValidHeader(""))); w.Code != http.StatusOK {
+		t.Errorf("old key rejected while retiring: %s", w.Body.String())
+	}
+	switched := authutil.NewAuthenticator()
+	switched.SetLegacyAuthHeader(false)
+	if err := switched.SetPublicKey(peerPublic); err != nil {
+		t.Fatal(err)
+	}
+	if w, _ := serve(t, f.Middleware(), requestWith(switched.GenerateAuthHeaderValue())); w.Code != http.StatusOK {
+		t.Errorf("new key rejected: %s", w.Body.String())
+	}
+
+	if err := f.Server.RemoveKey(f.KeyID); err != nil {
+		t.Fatalf("RemoveKey: %v", err)
+	}
+	w, _ := serve(t, f.Middleware(), requestWith(f.ValidHeader("")))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("removed key: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+}
+
+func TestLegacyHeaderRejectedInProd(t *testing.T) {
+	f := newFixture(t, authutil.ProfileProd)
+	f.Client.SetLegacyAuthHeader(true)
+	w, _ := serve(t, f.Middleware(), requestWith(f.ValidHeader("")))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("legacy header in prod: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+
+	f.Client.SetLegacyAuthHeader(false)
+	if w, _ := serve(t, f.Middleware(), requestWith(f.ValidHeader(""))); w.Code != http.StatusOK {
+		t.Errorf("keyed header in prod: %s", w.Body.String())
+	}
+}
@@ -0,0 +1,44 @@
+package authutil
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sync/atomic"
+)
+
+// metrics 认证结果计数
+type metrics struct {
+	verified int64
+	rejected int64
+	replayed int64
+}
+
+// AuthStats 认证结果统计
+type AuthStats struct {
+	Verified int64 `json:"verified"` // 通过校验的请求数
+	Rejected int64 `json:"rejected"` // 未通过校验的请求数，包含重放
+	Replayed int64 `json:"replayed"` // 因重放被拒绝的请求数
+}
+
+func (m *metrics) snapshot() AuthStats {
+	return AuthStats{
+		Verified: atomic.LoadInt64(&m.verified),
+		Rejected: atomic.LoadInt64(&m.rejected),
+		Replayed: atomic.LoadInt64(&m.replayed),
+	}
+}
+
+// Stats 获取认证结果统计
+func (a *Authenticator) Stats() AuthStats {
+	return a.metrics.snapshot()
+}
+
+// StatsFunc 认证结果统计接口
+func (a *Authenticator) StatsFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    a.Stats(),
+	})
+}
@@ -0,0 +1,140 @@
+package authutil_test
+
+import (
+	"encoding/json"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareAuthHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile authutil.Profile
+		header  func(f *authtest.Fixture) (string, string)
+		code    int
+	}{
+		{"valid", authutil.ProfileTest, func(f *authtest.Fixture) (string, string) { return f.ValidHeader("") }, 2000},
+		{"missing", authutil.ProfileTest, func(f *authtest.Fixture) (string, string) { return "", "" }, authutil.CodeAuthEmpty},
+		{"expired", authutil.ProfileTest, func(f *authtest.Fixture) (string, string) { return f.ExpiredHeader("") }, authutil.CodeAuthExpired},
+		{"replayed", authutil.ProfileTest, func(f *authtest.Fixture) (string, string) { return f.ReplayedHeader("") }, authutil.CodeAuthReplayed},
+		{"tampered", authutil.ProfileTest, func(f *authtest.Fixture) (string, string) { return f.TamperedHeader("") }, authutil.CodeAuthUndecryptable},
+		{"malformed outside dev", authutil.ProfileTest, func(f *authtest.Fixture) (string, string) { return f.MalformedHeader() }, authutil.CodeAuthUndecryptable},
+		{"malformed in dev", authutil.ProfileDev, func(f *authtest.Fixture) (string, string) { return f.MalformedHeader() }, authutil.CodeAuthMalformed},
+		{"tampered in dev", authutil.ProfileDev, func(f *authtest.Fixture) (string, string) { return f.TamperedHeader("") }, authutil.CodeAuthUndecryptable},
+		{"wrong audience", authutil.ProfileTest, func(f *authtest.Fixture) (string, string) { return f.ValidHeader("billing") }, authutil.CodeAuthWrongAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, tt.profile, authtest.WithService("inventory"))
+			w, _ := serve(t, f.Middleware(), requestWith(tt.header(f)))
+			if code := authtest.ResponseCode(t, w); code != tt.code {
+				t.Errorf("code = %d, want %d, body %s", code, tt.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareFailureResponse(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev, authtest.WithService("inventory"))
+	w, _ := serve(t, f.Middleware(), requestWith(f.ExpiredHeader("")))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if got := w.Header().Get("WWW-Authenticate"); !strings.Contains(got, `realm="inventory"`) || !strings.Contains(got, `error="invalid_token"`) {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+	var resp struct {
+		Data authutil.AuthFailureDetail `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || len(resp.Data.Reason) == 0 {
+		t.Errorf("dev response has no reason: %s", w.Body.String())
+	}
+
+	// 未携带认证信息时只提示认证方式
+	w, _ = serve(t, f.Middleware(), requestWith("", ""))
+	if got := w.Header().Get("WWW-Authenticate"); strings.Contains(got, "error=") {
+		t.Errorf("WWW-Authenticate = %q", got)
+	}
+}
+
+func TestMiddlewareAuthHeaderIdentity(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest, authtest.WithService("inventory"), authtest.WithCaller("order"))
+	w, identity := serve(t, f.Middleware(), requestWith(f.ValidHeader("inventory", "stock:read")))
+	if code := authtest.ResponseCode(t, w); code != 2000 {
+		t.Fatalf("code = %d, want 2000, body %s", code, w.Body.String())
+	}
+	if identity.Method != authutil.MethodHeader || identity.Service != "order" || !identity.HasScope("stock:read") || identity.HasScope("stock:write") {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+func TestMiddlewareAudience(t *testing.T) {
+	tests := []struct {
+		name     string
+		audience string
+		strict   bool
+		code     int
+	}{
+		{"matching", "inventory", false, 2000},
+		{"other service", "billing", false, authutil.CodeAuthWrongAudience},
+		{"unset", "", false, 2000},
+		{"unset when required", "", true, authutil.CodeAuthWrongAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t, authutil.ProfileTest, authtest.WithService("inventory"))
+			f.Server.SetRequireAudience(tt.strict)
+			w, _ := serve(t, f.Middleware(), requestWith(f.ValidHeader(tt.audience)))
+			if code := authtest.ResponseCode(t, w); code != tt.code {
+				t.Errorf("code = %d, want %d, body %s", code, tt.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMiddlewareGateway(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	w, identity := serve(t, f.Middleware(), requestWith(f.GatewayHeader("42", true)))
+	if code := authtest.ResponseCode(t, w); code != 2000 {
+		t.Fatalf("code = %d, want 2000, body %s", code, w.Body.String())
+	}
+	if identity.Method != authutil.MethodGateway || identity.UserId != "42" || !identity.IsAdmin {
+		t.Errorf("identity = %+v", identity)
+	}
+
+	// 旧版本网关把内容放在 X-LincService-Auth 中，兼容期内同样接受
+	_, value := f.GatewayHeader("7", false)
+	w, identity = serve(t, f.Middleware(), requestWith(authutil.HeaderInternalServiceAuth, value))
+	if code := authtest.ResponseCode(t, w); code != 2000 || identity.UserId != "7" {
+		t.Errorf("legacy gateway header: code = %d, identity = %+v", code, identity)
+	}
+}
+
+func TestMiddlewareQueryString(t *testing.T) {
+	tests := []struct {
+		profile authutil.Profile
+		code    int
+	}{
+		{authutil.ProfileUnset, authutil.CodeAuthEmpty},
+		{authutil.ProfileProd, authutil.CodeAuthEmpty},
+		{authutil.ProfileDev, 2000},
+		{authutil.ProfileTest, 2000},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.profile), func(t *testing.T) {
+			f := newFixture(t, tt.profile)
+			f.Client.SetLegacyAuthHeader(tt.profile != authutil.ProfileProd)
+			name, value := f.ValidHeader("")
+			req := httptest.NewRequest(http.MethodGet, "/download?"+url.Values{name: {value}}.Encode(), nil)
+			w, _ := serve(t, f.Middleware(), req)
+			if code := authtest.ResponseCode(t, w); code != tt.code {
+				t.Errorf("code = %d, want %d", code, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+package authutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/datautil"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	certDirName         = "certs"
+	serviceURIScheme    = "linc-service" // 服务证书中标识服务名称的 URI SAN，形如 linc-service://order
+	defaultCAValidity   = 10 * 365 * 24 * time.Hour
+	defaultCertValidity = 30 * 24 * time.Hour // 服务证书默认有效期
+	defaultCertRenewal  = 7 * 24 * time.Hour  // 证书到期前多久开始续期
+)
+
+var (
+	errNoPeerCertificate = errors.New("peer certificate is missing")
+	errNoServiceName     = errors.New("peer certificate has no service name")
+	errUntrustedPeer     = errors.New("peer certificate is not issued by the service CA")
+)
+
+// DefaultCertificateDir 数据目录下存放 CA 和服务证书的 certs 文件夹
+func DefaultCertificateDir() string {
+	return filepath.Join(datautil.GetRelDataPath(), certDirName)
+}
+
+/*****************************************************************
+*							本地 CA
+*****************************************************************/
+
+// CertificateAuthority 本地证书颁发机构，用于签发服务间双向 TLS 使用的证书
+type CertificateAuthority struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM string
+}
+
+// NewCertificateAuthority 创建自签名的 CA，使用 ECDSA P-256 密钥；validity 不大于 0 时有效期为十年
+func NewCertificateAuthority(name string, validity time.Duration) (*CertificateAuthority, string, error) {
+	if validity <= 0 {
+		validity = defaultCAValidity
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, "", err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, "", err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, "", err
+	}
+	keyPEM, err := marshalECPrivateKeyPEM(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ca := &CertificateAuthority{cert: cert, key: key, certPEM: encodeCertificatePEM(der)}
+	return ca, keyPEM, nil
+}
+
+// LoadCertificateAuthority 从 PEM 加载 CA 证书和私钥
+func LoadCertificateAuthority(certPEM string, keyPEM string) (*CertificateAuthority, error) {
+	pair, err := tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, errUnsupportedKey
+	}
+	return &CertificateAuthority{cert: cert, key: key, certPEM: certPEM}, nil
+}
+
+// LoadOrCreateCertificateAuthority 从 dir 下的 ca.pem 和 ca-key.pem 加载 CA，不存在时创建并写入，私钥权限为 0600
+func LoadOrCreateCertificateAuthority(dir string, name string) (*CertificateAuthority, error) {
+	certFile, keyFile := filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem")
+
+	certPEM, certErr := os.ReadFile(certFile)
+	if certErr == nil {
+		if _, err := checkKeyFilePermissions(keyFile, true); err != nil {
+			return nil, err
+		}
+		keyPEM, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return LoadCertificateAuthority(string(certPEM), string(keyPEM))
+	}
+	if !errors.Is(certErr, os.ErrNotExist) {
+		return nil, certErr
+	}
+
+	ca, keyPEM, err := NewCertificateAuthority(name, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(keyFile, []byte(keyPEM), 0600); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(certFile, []byte(ca.certPEM), 0644); err != nil {
+		return nil, err
+	}
+	logutil.Println("已创建本地 CA：", certFile)
+	return ca, nil
+}
+
+// CertificatePEM CA 证书，分发给各服务用于校验对端证书
+func (ca *CertificateAuthority) CertificatePEM() string {
+	return ca.certPEM
+}
+
+// IssueServiceCertificate 签发服务证书，服务名称同时写入 DNS SAN 和 linc-service:// URI SAN，hosts 为额外的域名或 IP；
+// 证书同时可用于服务端和客户端，返回证书和私钥 PEM；validity 不大于 0 时有效期为三十天
+func (ca *CertificateAuthority) IssueServiceCertificate(service string, validity time.Duration, hosts ...string) (string, string, error) {
+	if len(service) == 0 {
+		return "", "", errNoServiceName
+	}
+	if validity <= 0 {
+		validity = defaultCertValidity
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	serial, err := newSerialNumber()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: service},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{service},
+		URIs:         []*url.URL{{Scheme: serviceURIScheme, Host: service}},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != service {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, key.Public(), ca.key)
+	if err != nil {
+		return "", "", err
+	}
+	keyPEM, err := marshalECPrivateKeyPEM(key)
+	if err != nil {
+		return "", "", err
+	}
+	return encodeCertificatePEM(der), keyPEM, nil
+}
+
+func newSerialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+func encodeCertificatePEM(der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func marshalECPrivateKeyPEM(key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})), nil
+}
+
+// ServiceNameOf 从证书的 linc-service:// URI SAN 中获取服务名称；CN 可以由任意 CA 随意填写，不作为服务名称
+func ServiceNameOf(cert *x509.Certificate) (string, error) {
+	for _, uri := range cert.URIs {
+		if uri.Scheme == serviceURIScheme && len(uri.Host) > 0 {
+			return uri.Host, nil
+		}
+	}
+	return "", errNoServiceName
+}
+
+/*****************************************************************
+*							证书重新加载
+*****************************************************************/
+
+// CertificateReloader 从文件加载服务证书并在文件变化或即将过期时替换，供 tls.Config 的回调使用
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	leaf     *x509.Certificate
+	stamps   map[string]fileStamp
+	renew    func() error
+	renewAt  time.Duration
+	stop     chan struct{}
+	lastErr  error
+	loadedAt time.Time
+}
+
+// NewCertificateReloader 加载证书和私钥文件，私钥权限必须是 0600 或更严格
+func NewCertificateReloader(certFile string, keyFile string) (*CertificateReloader, error) {
+	r := &CertificateReloader{certFile: certFile, keyFile: keyFile, renewAt: defaultCertRenewal}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload 重新加载证书，失败时保留原有证书；只有加载成功才记录文件状态，失败后每次检查都会重试
+func (r *CertificateReloader) Reload() error {
+	// 读取之前记录文件状态，读取期间文件再次变化时下一次检查会重新加载
+	stamps := stampKeyFiles(KeyFiles{PublicKey: r.certFile, PrivateKey: r.keyFile})
+
+	err := func() error {
+		if _, err := checkKeyFilePermissions(r.keyFile, true); err != nil {
+			return err
+		}
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return err
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return err
+		}
+		cert.Leaf = leaf
+
+		r.mu.Lock()
+		r.cert, r.leaf = &cert, leaf
+		r.stamps = stamps
+		r.loadedAt = time.Now()
+		r.mu.Unlock()
+		logutil.Println("证书加载成功：", r.certFile, "有效期至", leaf.NotAfter.Format(time.RFC3339))
+		return nil
+	}()
+
+	r.mu.Lock()
+	r.lastErr = err
+	r.mu.Unlock()
+	if err != nil {
+		logutil.Errorf("证书加载失败，继续使用原有证书：%v", err)
+	}
+	return err
+}
+
+// SetRenewal 设置续期：证书距离过期不足 before 时调用 renew 重新签发并写入文件，随后重新加载
+func (r *CertificateReloader) SetRenewal(before time.Duration, renew func() error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.renewAt = before
+	r.renew = renew
+}
+
+// NotAfter 当前证书的过期时间
+func (r *CertificateReloader) NotAfter() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.leaf.NotAfter
+}
+
+// Watch 每隔 interval 检查一次，证书文件变化或即将过期时重新加载
+func (r *CertificateReloader) Watch(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	r.mu.Lock()
+	if r.stop != nil {
+		close(r.stop)
+	}
+	stop := make(chan struct{})
+	r.stop = stop
+	r.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				r.check()
+			}
+		}
+	}()
+}
+
+// Stop 停止监视
+func (r *CertificateReloader) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stop != nil {
+		close(r.stop)
+		r.stop = nil
+	}
+}
+
+func (r *CertificateReloader) check() {
+	r.mu.RLock()
+	renew, renewAt, notAfter := r.renew, r.renewAt, r.leaf.NotAfter
+	loader := keyFileLoader{files: KeyFiles{PublicKey: r.certFile, PrivateKey: r.keyFile}, stamps: r.stamps}
+	r.mu.RUnlock()
+
+	if renew != nil && time.Until(notAfter) < renewAt {
+		logutil.Println("证书即将过期，开始续期：", r.certFile)
+		if err := renew(); err != nil {
+			logutil.Errorf("证书续期失败：%v", err)
+			return
+		}
+		_ = r.Reload()
+		return
+	}
+	if loader.changed() {
+		_ = r.Reload()
+	}
+}
+
+// GetCertificate 用于 tls.Config.GetCertificate
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// GetClientCertificate 用于 tls.Config.GetClientCertificate
+func (r *CertificateReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// IssueServiceCertificateFiles 使用 CA 签发服务证书并写入文件，可直接作为 CertificateReloader 的续期函数
+func IssueServiceCertificateFiles(ca *CertificateAuthority, service string, validity time.Duration, certFile string, keyFile string, hosts ...string) error {
+	certPEM, keyPEM, err := ca.IssueServiceCertificate(service, validity, hosts...)
+	if err != nil {
+		return err
+	}
+	// 先写私钥再写证书，避免重新加载时证书与旧私钥不匹配；加载失败会在下一次检查时重试
+	if err := writeFileAtomic(keyFile, []byte(keyPEM), 0600); err != nil {
+		return err
+	}
+	return writeFileAtomic(certFile, []byte(certPEM), 0644)
+}
+
+/*****************************************************************
+*							tls.Config
+*****************************************************************/
+
+func certPoolOf(caPEM string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(caPEM)) {
+		return nil, errors.New("failed to parse CA certificate")
+	}
+	return pool, nil
+}
+
+// ServerTLSConfig 要求客户端出示由 caPEM 签发的证书的服务端配置
+func ServerTLSConfig(caPEM string, reloader *CertificateReloader) (*tls.Config, error) {
+	pool, err := certPoolOf(caPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool,
+		GetCertificate: reloader.GetCertificate,
+	}, nil
+}
+
+// ClientTLSConfig 校验服务端证书由 caPEM 签发且包含 serverName，并出示自己证书的客户端配置
+func ClientTLSConfig(caPEM string, reloader *CertificateReloader, serverName string) (*tls.Config, error) {
+	pool, err := certPoolOf(caPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		RootCAs:              pool,
+		ServerName:           serverName,
+		GetClientCertificate: reloader.GetClientCertificate,
+	}, nil
+}
+
+/*****************************************************************
+*							身份
+*****************************************************************/
+
+// SetServiceCA 设置签发服务证书的 CA，只有由它签发的客户端证书才会被映射为 mtls 身份；
+// 监听器的 ClientCAs 可能包含其他 CA，未设置时不接受任何客户端证书
+func (a *Authenticator) SetServiceCA(caPEM string) error {
+	pool, err := certPoolOf(caPEM)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.serviceCAs = pool
+	return nil
+}
+
+// verifyPeerCertificate 用本认证器的服务 CA 重新校验客户端证书链，并从中获取调用方身份
+func (a *Authenticator) verifyPeerCertificate(req *http.Request) (Identity, error) {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return Identity{}, errNoPeerCertificate
+	}
+	a.mu.RLock()
+	roots := a.serviceCAs
+	a.mu.RUnlock()
+	if roots == nil {
+		return Identity{}, fmt.Errorf("%w: service CA is not set", errUntrustedPeer)
+	}
+
+	cert := req.TLS.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, c := range req.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   a.currentTime(),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", errUntrustedPeer, err)
+	}
+
+	service, err := ServiceNameOf(cert)
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{
+		Method:  MethodMTLS,
+		Service: service,
+		KeyID:   cert.SerialNumber.Text(16),
+	}, nil
+}
+
+// RequireMutualTLS 要求请求通过双向 TLS 连接，网关验证、可信访问请求头和请求签名都不再放行
+func RequireMutualTLS() MiddlewareOption {
+	return func(config *middlewareConfig) {
+		config.requireMutualTLS = true
+	}
+}
+
+// AuthenticateMutualTLS 仅接受双向 TLS 连接的请求，并返回证书中的服务身份
+func (a *Authenticator) AuthenticateMutualTLS(req *http.Request) (Identity, error) {
+	identity, err := a.verifyPeerCertificate(req)
+	return identity, a.count(err)
+}
@@ -0,0 +1,184 @@
+package authutil_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCA(t *testing.T, name string) *authutil.CertificateAuthority {
+	t.Helper()
+	ca, _, err := authutil.NewCertificateAuthority(name, 0)
+	if err != nil {
+		t.Fatalf("NewCertificateAuthority: %v", err)
+	}
+	return ca
+}
+
+func parseCertificatePEM(t *testing.T, certPEM string) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		t.Fatal("invalid certificate PEM")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+// mtlsRequest 模拟客户端出示了 certPEM 的双向 TLS 请求
+func mtlsRequest(t *testing.T, certPEM string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{parseCertificatePEM(t, certPEM)}}
+	return req
+}
+
+func TestIssueServiceCertificate(t *testing.T) {
+	ca := newCA(t, "test-ca")
+	certPEM, _, err := ca.IssueServiceCertificate("order", 0, "10.0.0.8", "order.local")
+	if err != nil {
+		t.Fatalf("IssueServiceCertificate: %v", err)
+	}
+	cert := parseCertificatePEM(t, certPEM)
+
+	// 未指定有效期时为三十天
+	if validity := time.Until(cert.NotAfter); validity < 29*24*time.Hour || validity > 30*24*time.Hour {
+		t.Errorf("validity = %s, want 30 days", validity)
+	}
+	if service, err := authutil.ServiceNameOf(cert); err != nil || service != "order" {
+		t.Errorf("ServiceNameOf = %q, %v", service, err)
+	}
+	if len(cert.IPAddresses) != 1 || !strings.Contains(strings.Join(cert.DNSNames, ","), "order.local") {
+		t.Errorf("SANs = %v %v", cert.DNSNames, cert.IPAddresses)
+	}
+}
+
+func TestServiceNameIgnoresCommonName(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "order"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service, err := authutil.ServiceNameOf(cert); err == nil {
+		t.Errorf("ServiceNameOf accepted the CN as %q", service)
+	}
+}
+
+func TestAuthenticateMutualTLS(t *testing.T) {
+	ca := newCA(t, "service-ca")
+	other := newCA(t, "partner-ca")
+	trusted, _, err := ca.IssueServiceCertificate("order", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, _, err := other.IssueServiceCertificate("order", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未设置服务 CA 时不接受任何客户端证书
+	f := newFixture(t, authutil.ProfileDev)
+	if _, err := f.Server.AuthenticateMutualTLS(mtlsRequest(t, trusted)); err == nil {
+		t.Error("client certificate accepted without a service CA")
+	}
+
+	if err := f.Server.SetServiceCA(ca.CertificatePEM()); err != nil {
+		t.Fatalf("SetServiceCA: %v", err)
+	}
+	w, identity := serve(t, f.Middleware(authutil.RequireMutualTLS()), mtlsRequest(t, trusted))
+	if w.Code != http.StatusOK || identity.Method != authutil.MethodMTLS || identity.Service != "order" || !identity.IsPrivileged() {
+		t.Errorf("trusted certificate: status = %d, identity = %+v", w.Code, identity)
+	}
+
+	// 监听器信任的其他 CA 签发的同名证书不能冒充服务
+	w, _ = serve(t, f.Middleware(authutil.RequireMutualTLS()), mtlsRequest(t, foreign))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("foreign certificate: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+
+	// 只接受双向 TLS 时其他认证方式不再放行
+	w, _ = serve(t, f.Middleware(authutil.RequireMutualTLS()), requestWith(f.ValidHeader("")))
+	if w.Code == http.StatusOK {
+		t.Error("auth header accepted with RequireMutualTLS")
+	}
+}
+
+func TestCertificateReloaderRetriesFailedLoad(t *testing.T) {
+	ca := newCA(t, "service-ca")
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "order.pem"), filepath.Join(dir, "order-key.pem")
+	if err := authutil.IssueServiceCertificateFiles(ca, "order", time.Hour, certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	r, err := authutil.NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader: %v", err)
+	}
+	first := r.NotAfter()
+
+	// 续期时新证书已写入而私钥只写了一半，此时加载失败
+	time.Sleep(10 * time.Millisecond)
+	certPEM, keyPEM, err := ca.IssueServiceCertificate("order", 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp := time.Now().Add(-time.Minute)
+	write := func(path string, data string) {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, stamp, stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(certFile, certPEM)
+	write(keyFile, strings.Repeat("-", len(keyPEM)))
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload with a partial key succeeded")
+	}
+	if !r.NotAfter().Equal(first) {
+		t.Fatal("failed reload replaced the certificate")
+	}
+
+	// 私钥写完后大小和修改时间都与失败时相同，仍然需要重试
+	write(keyFile, keyPEM)
+	r.Watch(10 * time.Millisecond)
+	defer r.Stop()
+	deadline := time.Now().Add(2 * time.Second)
+	for r.NotAfter().Equal(first) {
+		if time.Now().After(deadline) {
+			t.Fatal("certificate was not reloaded after the failed load")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,223 @@
+package authutil
+
+import (
+	"container/list"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNonceCapacity = 100000      // 内存中最多记录的随机数数量
+	nonceCleanupInterval = time.Minute // 共享存储的过期清理间隔
+)
+
+// ErrNonceStoreFull 随机数存储已满且没有可清理的过期记录，此时拒绝新请求，不能淘汰仍在有效期内的记录
+var ErrNonceStoreFull = errors.New("nonce store is full")
+
+// NonceStore 记录已使用过的随机数，用于防止请求头被重放
+type NonceStore interface {
+	// Remember 记录随机数，直到 expiresAt 之前再次出现都视为重放，此时返回 false
+	Remember(nonce string, expiresAt time.Time) (bool, error)
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+/*****************************************************************
+*							内存存储
+*****************************************************************/
+
+type nonceEntry struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// MemoryNonceStore 有界、自动过期的内存随机数存储
+type MemoryNonceStore struct {
+	mu       sync.Mutex
+	capacity int
+	now      func() time.Time
+	entries  map[string]*list.Element
+	order    list.List // 按记录先后排序，越靠前越早过期
+}
+
+// NewMemoryNonceStore 创建内存随机数存储，capacity 为最多记录的数量
+func NewMemoryNonceStore(capacity int) *MemoryNonceStore {
+	if capacity <= 0 {
+		capacity = defaultNonceCapacity
+	}
+	return &MemoryNonceStore{
+		capacity: capacity,
+		now:      time.Now,
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryNonceStore) Remember(nonce string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.evictExpiredLocked(now)
+
+	if elem, ok := s.entries[nonce]; ok {
+		if elem.Value.(*nonceEntry).expiresAt.After(now) {
+			return false, nil
+		}
+		s.order.Remove(elem)
+		delete(s.entries, nonce)
+	}
+
+	// 已满时只清理过期的记录；淘汰未过期的记录会使攻击者可以先灌满存储再重放
+	if s.order.Len() >= s.capacity {
+		s.sweepExpiredLocked(now)
+		if s.order.Len() >= s.capacity {
+			return false, ErrNonceStoreFull
+		}
+	}
+
+	s.entries[nonce] = s.order.PushBack(&nonceEntry{nonce: nonce, expiresAt: expiresAt})
+	return true, nil
+}
+
+func (s *MemoryNonceStore) evictExpiredLocked(now time.Time) {
+	for {
+		oldest := s.order.Front()
+		if oldest == nil || oldest.Value.(*nonceEntry).expiresAt.After(now) {
+			return
+		}
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*nonceEntry).nonce)
+	}
+}
+
+// sweepExpiredLocked 遍历全部记录清理过期的记录，有效期不同时过期记录不一定排在最前面
+func (s *MemoryNonceStore) sweepExpiredLocked(now time.Time) {
+	for elem := s.order.Front(); elem != nil; {
+		next := elem.Next()
+		if entry := elem.Value.(*nonceEntry); !entry.expiresAt.After(now) {
+			s.order.Remove(elem)
+			delete(s.entries, entry.nonce)
+		}
+		elem = next
+	}
+}
+
+/*****************************************************************
+*							共享存储
+*****************************************************************/
+
+// FileNonceStore 基于目录的随机数存储，同一设备上的多个进程共享同一目录即可互相识别重放
+type FileNonceStore struct {
+	dir string
+}
+
+// NewFileNonceStore 创建基于目录的随机数存储，并定期清理过期记录
+func NewFileNonceStore(dir string) (*FileNonceStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &FileNonceStore{dir: dir}
+
+	go func() {
+		ticker := time.NewTicker(nonceCleanupInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.Cleanup()
+		}
+	}()
+	return s, nil
+}
+
+// Remember 以独占方式创建记录文件，文件已存在且未过期即视为重放
+func (s *FileNonceStore) Remember(nonce string, expiresAt time.Time) (bool, error) {
+	sum := sha256.Sum256([]byte(nonce))
+	file := filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+	content := []byte(strconv.FormatInt(expiresAt.UnixMilli(), 10))
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, err = f.Write(content)
+			closeErr := f.Close()
+			if err == nil {
+				err = closeErr
+			}
+			return true, err
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+
+		// 记录已过期时删除后重试一次
+		if !s.expired(file, time.Now()) {
+			return false, nil
+		}
+		_ = os.Remove(file)
+	}
+	return false, nil
+}
+
+func (s *FileNonceStore) expired(file string, now time.Time) bool {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return errors.Is(err, os.ErrNotExist)
+	}
+	expiresAt, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		// 其他进程可能正在写入，保守地视为未过期
+		return false
+	}
+	return !time.UnixMilli(expiresAt).After(now)
+}
+
+// Cleanup 删除已过期的记录
+func (s *FileNonceStore) Cleanup() {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, file := range files {
+		path := filepath.Join(s.dir, file.Name())
+		if !file.IsDir() && s.expired(path, now) {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+/*****************************************************************
+*							组合存储
+*****************************************************************/
+
+type chainedNonceStore []NonceStore
+
+// ChainNonceStores 依次查询多个存储，常用于内存存储在前、共享存储在后
+func ChainNonceStores(stores ...NonceStore) NonceStore {
+	return chainedNonceStore(stores)
+}
+
+func (c chainedNonceStore) Remember(nonce string, expiresAt time.Time) (bool, error) {
+	for _, store := range c {
+		fresh, err := store.Remember(nonce, expiresAt)
+		if err != nil || !fresh {
+			return fresh, err
+		}
+	}
+	return true, nil
+}
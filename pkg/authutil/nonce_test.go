@@ -0,0 +1,114 @@
+package authutil_test
+
+import (
+	"errors"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestMemoryNonceStoreExpiry(t *testing.T) {
+	store := authutil.NewMemoryNonceStore(10)
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+
+	if fresh, err := store.Remember("n1", expiresAt); !fresh || err != nil {
+		t.Fatalf("first use: fresh = %v, err = %v", fresh, err)
+	}
+	if fresh, err := store.Remember("n1", expiresAt); fresh || err != nil {
+		t.Fatalf("replay: fresh = %v, err = %v", fresh, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if fresh, err := store.Remember("n1", time.Now().Add(time.Minute)); !fresh || err != nil {
+		t.Errorf("after expiry: fresh = %v, err = %v", fresh, err)
+	}
+}
+
+func TestMemoryNonceStoreFull(t *testing.T) {
+	store := authutil.NewMemoryNonceStore(2)
+	long := time.Now().Add(time.Minute)
+	short := time.Now().Add(50 * time.Millisecond)
+
+	// 过期时间不同，先过期的记录不在队首
+	if _, err := store.Remember("long", long); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Remember("short", short); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Remember("third", long); !errors.Is(err, authutil.ErrNonceStoreFull) {
+		t.Fatalf("full store: err = %v, want ErrNonceStoreFull", err)
+	}
+	// 已满时不能淘汰未过期的记录，否则可以先灌满再重放
+	if fresh, _ := store.Remember("long", long); fresh {
+		t.Error("unexpired nonce was evicted")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if fresh, err := store.Remember("third", long); !fresh || err != nil {
+		t.Errorf("after sweep: fresh = %v, err = %v", fresh, err)
+	}
+}
+
+func TestFileNonceStoreShared(t *testing.T) {
+	dir := t.TempDir()
+	first, err := authutil.NewFileNonceStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := authutil.NewFileNonceStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiresAt := time.Now().Add(50 * time.Millisecond)
+	if fresh, err := first.Remember("n1", expiresAt); !fresh || err != nil {
+		t.Fatalf("first use: fresh = %v, err = %v", fresh, err)
+	}
+	if fresh, err := second.Remember("n1", expiresAt); fresh || err != nil {
+		t.Fatalf("replay through another store: fresh = %v, err = %v", fresh, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if fresh, err := second.Remember("n1", time.Now().Add(time.Minute)); !fresh || err != nil {
+		t.Errorf("after expiry: fresh = %v, err = %v", fresh, err)
+	}
+}
+
+func TestFullNonceStoreRejectsRequests(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest)
+	f.Server.SetNonceStore(authutil.NewMemoryNonceStore(1))
+
+	if w, _ := serve(t, f.Middleware(), requestWith(f.ValidHeader(""))); w.Code != http.StatusOK {
+		t.Fatalf("first request: %s", w.Body.String())
+	}
+	w, _ := serve(t, f.Middleware(), requestWith(f.ValidHeader("")))
+	if w.Code != http.StatusServiceUnavailable || authtest.ResponseCode(t, w) != authutil.CodeAuthUnavailable {
+		t.Errorf("full store: status = %d, body = %s", w.Code, w.Body.String())
+	}
+}
+
+func TestFarFutureExpirationRejected(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	f.Server.SetValidity(10 * time.Second)
+	f.Server.SetClockSkew(time.Second)
+	f.Server.SetNonceStore(authutil.NewMemoryNonceStore(1))
+
+	// 持有公钥的调用方可以任意设置有效期
+	attacker := authutil.NewAuthenticator()
+	if err := attacker.SetPublicKey(f.PublicKeyPEM); err != nil {
+		t.Fatal(err)
+	}
+	attacker.SetValidity(365 * 24 * time.Hour)
+	w, _ := serve(t, f.Middleware(), requestWith(attacker.GenerateAuthHeaderValue()))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthMalformed {
+		t.Errorf("far-future header: code = %d, want %d", code, authutil.CodeAuthMalformed)
+	}
+
+	// 有效期加时钟误差以内的请求头仍然接受，被拒绝的请求头没有占用存储
+	f.Client.SetValidity(11 * time.Second)
+	if w, _ := serve(t, f.Middleware(), requestWith(f.ValidHeader(""))); w.Code != http.StatusOK {
+		t.Errorf("header within skew: %s", w.Body.String())
+	}
+}
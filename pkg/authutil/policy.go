@@ -0,0 +1,246 @@
+package authutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Profile 运行环境，决定是否允许不安全的配置以及兼容旧调用方的默认行为；任何运行环境都不默认放行请求
+type Profile string
+
+const (
+	ProfileUnset Profile = ""     // 未指定运行环境，按兼容旧调用方处理
+	ProfileDev   Profile = "dev"  // 开发环境，认证失败时返回具体原因
+	ProfileTest  Profile = "test" // 测试环境
+	ProfileProd  Profile = "prod" // 生产环境，拒绝调试模式和放行公网地址的规则
+)
+
+// EnvProfile 指定运行环境的环境变量，未设置时为 ProfileUnset，无法识别时按 prod 处理
+const EnvProfile = "LINC_PROFILE"
+
+var errInsecureInProd = errors.New("insecure auth policy is not allowed in prod profile")
+
+// ProfileFromEnv 从环境变量读取运行环境
+func ProfileFromEnv() Profile {
+	value := strings.ToLower(strings.TrimSpace(os.Getenv(EnvProfile)))
+	switch Profile(value) {
+	case ProfileUnset, ProfileDev, ProfileTest, ProfileProd:
+		return Profile(value)
+	default:
+		logutil.Println("无法识别的运行环境，按 prod 处理：", value)
+		return ProfileProd
+	}
+}
+
+/*****************************************************************
+*							放行规则
+*****************************************************************/
+
+// BypassRule 放行规则，命中的请求无需认证即可通过中间件
+type BypassRule struct {
+	name     string
+	match    func(req *http.Request) (string, bool) // 返回对端地址和是否命中
+	insecure bool                                   // 生产环境中是否禁止使用
+}
+
+// Name 规则名称，用于日志
+func (r BypassRule) Name() string {
+	return r.name
+}
+
+// AllowLoopback 放行来自本机回环地址的请求；只看 TCP 连接的对端地址，不信任 X-Forwarded-For 等请求头
+func AllowLoopback() BypassRule {
+	return BypassRule{
+		name: "loopback",
+		match: func(req *http.Request) (string, bool) {
+			ip := remoteIP(req)
+			return ip.String(), ip != nil && ip.IsLoopback()
+		},
+	}
+}
+
+// AllowCIDRs 放行来自指定网段的请求，生产环境中只允许内网网段
+func AllowCIDRs(cidrs ...string) (BypassRule, error) {
+	var networks []*net.IPNet
+	insecure := false
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return BypassRule{}, err
+		}
+		networks = append(networks, network)
+		if !isInternalNetwork(network) {
+			insecure = true
+		}
+	}
+
+	return BypassRule{
+		name: "cidr " + strings.Join(cidrs, ","),
+		match: func(req *http.Request) (string, bool) {
+			ip := remoteIP(req)
+			if ip == nil {
+				return "", false
+			}
+			for _, network := range networks {
+				if network.Contains(ip) {
+					return ip.String(), true
+				}
+			}
+			return ip.String(), false
+		},
+		insecure: insecure,
+	}, nil
+}
+
+// AllowUnixSocket 放行通过 Unix 套接字连接的请求，访问控制交由套接字文件的权限
+func AllowUnixSocket() BypassRule {
+	return BypassRule{
+		name: "unix",
+		match: func(req *http.Request) (string, bool) {
+			addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+			if !ok || addr.Network() != "unix" {
+				return "", false
+			}
+			return "unix:" + addr.String(), true
+		},
+	}
+}
+
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// isInternalNetwork 网段的首尾地址都是回环或内网地址
+func isInternalNetwork(network *net.IPNet) bool {
+	first := network.IP
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^network.Mask[i]
+	}
+	internal := func(ip net.IP) bool {
+		return ip.IsLoopback() || ip.IsPrivate()
+	}
+	return internal(first) && internal(last)
+}
+
+/*****************************************************************
+*							策略
+*****************************************************************/
+
+// bypassPolicy 放行规则和已记录过日志的对端
+type bypassPolicy struct {
+	rules  []BypassRule
+	logged sync.Map // 规则名称 + 对端地址 -> struct{}
+}
+
+func (p *bypassPolicy) match(req *http.Request) (BypassRule, string, bool) {
+	for _, rule := range p.rules {
+		if peer, ok := rule.match(req); ok {
+			return rule, peer, true
+		}
+	}
+	return BypassRule{}, "", false
+}
+
+// logOnce 每个对端在每条规则下只记录一次放行日志
+func (p *bypassPolicy) logOnce(rule BypassRule, peer string) {
+	if _, loaded := p.logged.LoadOrStore(rule.name+"|"+peer, struct{}{}); !loaded {
+		logutil.Printf("[InternalServiceAuth] 按规则 %s 放行对端 %s，后续不再记录\n", rule.name, peer)
+	}
+}
+
+// SetProfile 设置运行环境，并把是否要求随机数以及是否使用 RSA1_5 重置为该环境的默认值，放行规则保持不变；当前配置在生产环境中不安全时返回错误且不做修改
+func (a *Authenticator) SetProfile(profile Profile) error {
+	switch profile {
+	case ProfileDev, ProfileTest, ProfileProd:
+	default:
+		return fmt.Errorf("unknown profile %q", profile)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if profile == ProfileProd {
+		if a.debugMode {
+			return fmt.Errorf("%w: debug mode is enabled", errInsecureInProd)
+		}
+		for _, rule := range a.bypass.rules {
+			if rule.insecure {
+				return fmt.Errorf("%w: rule %s", errInsecureInProd, rule.name)
+			}
+		}
+	}
+	a.profile = profile
+	a.strictNon = profile == ProfileProd
+	a.legacyHdr = profile != ProfileProd
+	a.legacyKW = profile != ProfileProd
+	logutil.Println("认证运行环境：", profile)
+	return nil
+}
+
+// SetBypassRules 替换放行规则；生产环境中包含放行公网地址的规则时返回错误且不做修改
+func (a *Authenticator) SetBypassRules(rules ...BypassRule) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.profile == ProfileProd {
+		for _, rule := range rules {
+			if rule.insecure {
+				return fmt.Errorf("%w: rule %s", errInsecureInProd, rule.name)
+			}
+		}
+	}
+	a.bypass = &bypassPolicy{rules: rules}
+	return nil
+}
+
+// Profile 获取运行环境
+func (a *Authenticator) Profile() Profile {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.profile
+}
+
+// Validate 检查当前配置能否在所处运行环境中安全运行
+func (a *Authenticator) Validate() error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.profile != ProfileProd {
+		return nil
+	}
+	if a.debugMode {
+		return fmt.Errorf("%w: debug mode is enabled", errInsecureInProd)
+	}
+	for _, rule := range a.bypass.rules {
+		if rule.insecure {
+			return fmt.Errorf("%w: rule %s", errInsecureInProd, rule.name)
+		}
+	}
+	return nil
+}
+
+// checkBypass 判断请求是否命中调试模式或放行规则
+func (a *Authenticator) checkBypass(req *http.Request) (Identity, bool) {
+	a.mu.RLock()
+	debug, policy := a.debugMode, a.bypass
+	a.mu.RUnlock()
+
+	if debug {
+		logutil.Println("[InternalServiceAuth] 调试模式放行")
+		return Identity{Method: MethodDebug}, true
+	}
+	rule, peer, ok := policy.match(req)
+	if !ok {
+		return Identity{}, false
+	}
+	policy.logOnce(rule, peer)
+	return Identity{Method: MethodBypass}, true
+}
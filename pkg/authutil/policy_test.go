@@ -0,0 +1,117 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfileFromEnv(t *testing.T) {
+	tests := []struct {
+		value string
+		want  authutil.Profile
+	}{
+		{"", authutil.ProfileUnset},
+		{"dev", authutil.ProfileDev},
+		{" Test ", authutil.ProfileTest},
+		{"prod", authutil.ProfileProd},
+		{"staging", authutil.ProfileProd},
+	}
+	for _, tt := range tests {
+		t.Setenv(authutil.EnvProfile, tt.value)
+		if got := authutil.ProfileFromEnv(); got != tt.want {
+			t.Errorf("ProfileFromEnv() with %q = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func loopbackRequest() *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	req.RemoteAddr = "127.0.0.1:40000"
+	return req
+}
+
+func TestNoBypassByDefault(t *testing.T) {
+	for _, profile := range []authutil.Profile{authutil.ProfileUnset, authutil.ProfileDev, authutil.ProfileTest, authutil.ProfileProd} {
+		t.Run(string(profile), func(t *testing.T) {
+			t.Setenv(authutil.EnvProfile, string(profile))
+			a := authutil.NewAuthenticator()
+			w, _ := serve(t, a.Middleware(), loopbackRequest())
+			if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthEmpty {
+				t.Errorf("code = %d, want %d", code, authutil.CodeAuthEmpty)
+			}
+		})
+	}
+}
+
+func TestLoopbackBypassOptIn(t *testing.T) {
+	t.Setenv(authutil.EnvProfile, "")
+	a := authutil.NewAuthenticator()
+	if err := a.SetBypassRules(authutil.AllowLoopback()); err != nil {
+		t.Fatal(err)
+	}
+
+	w, identity := serve(t, a.Middleware(), loopbackRequest())
+	if code := authtest.ResponseCode(t, w); code != 2000 {
+		t.Fatalf("code = %d, want 2000", code)
+	}
+	if identity.Method != authutil.MethodBypass || identity.IsPrivileged() {
+		t.Errorf("identity = %+v, privileged = %v", identity, identity.IsPrivileged())
+	}
+
+	// 其他地址不受影响
+	req := loopbackRequest()
+	req.RemoteAddr = "10.0.0.8:40000"
+	w, _ = serve(t, a.Middleware(), req)
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthEmpty {
+		t.Errorf("remote code = %d, want %d", code, authutil.CodeAuthEmpty)
+	}
+}
+
+func TestProdRejectsInsecurePolicy(t *testing.T) {
+	t.Setenv(authutil.EnvProfile, "")
+	public, err := authutil.AllowCIDRs("0.0.0.0/0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := authutil.NewAuthenticator()
+	if err := a.SetBypassRules(public); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetProfile(authutil.ProfileProd); err == nil {
+		t.Error("SetProfile(prod) with a public CIDR rule succeeded")
+	}
+
+	a = authutil.NewAuthenticator()
+	if err := a.SetProfile(authutil.ProfileProd); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetBypassRules(public); err == nil {
+		t.Error("SetBypassRules with a public CIDR rule succeeded in prod")
+	}
+	if err := a.SetBypassRules(authutil.AllowLoopback()); err != nil {
+		t.Errorf("SetBypassRules(AllowLoopback()) in prod: %v", err)
+	}
+}
+
+func TestProdHidesFailureDetail(t *testing.T) {
+	f := newFixture(t, authutil.ProfileProd)
+
+	// 格式错误与无法解密返回同一个错误码，且不附带原因
+	for _, header := range []func() (string, string){
+		f.MalformedHeader,
+		func() (string, string) { return f.TamperedHeader("") },
+	} {
+		w, _ := serve(t, f.Middleware(), requestWith(header()))
+		if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+			t.Errorf("code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+		}
+		if strings.Contains(w.Body.String(), "reason") {
+			t.Errorf("prod response leaks the reason: %s", w.Body.String())
+		}
+	}
+}
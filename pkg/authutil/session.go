@@ -0,0 +1,363 @@
+package authutil
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	headerSession = "X-LincService-Session"
+
+	HeaderSession = headerSession // 会话请求头，格式为 <ticket>.<timestamp>.<nonce>.<mac>
+
+	defaultSessionTTL      = 10 * time.Minute // 会话默认有效期
+	defaultSessionCapacity = 4096             // 接收方缓存的会话数上限
+	sessionMACContext      = "LSS1"
+)
+
+var (
+	invalidSession    = errors.New("invalid session header")
+	unverifiedSession = errors.New("session header cannot be verified")
+	expiredSession    = errors.New("session is expired")
+)
+
+// sessionClaims 会话票据中加密保存的内容，Key 为双方共享的 HMAC 密钥
+type sessionClaims struct {
+	ID         string   `json:"sid"`
+	Key        []byte   `json:"key"`
+	Expiration int64    `json:"exp"` // 会话过期时间，UTC时间戳
+	Service    string   `json:"service,omitempty"`
+	Audience   string   `json:"audience,omitempty"`
+	Scopes     []string `json:"scopes,omitempty"`
+}
+
+// clientSession 调用方缓存的会话
+type clientSession struct {
+	ticket     string
+	claims     sessionClaims
+	expiration time.Time
+	refreshAt  time.Time // 到达该时间后换用新会话，留出时钟误差和请求耗时的余量
+}
+
+// sessionCache 调用方按目标服务缓存会话，接收方按封装票据的密钥 ID 和票据摘要缓存解出的会话
+type sessionCache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	clients  map[string]*clientSession
+	verified map[string]map[string]sessionClaims // 密钥 ID -> 票据摘要 -> 会话
+	count    int
+}
+
+func newSessionCache() *sessionCache {
+	return &sessionCache{
+		ttl:      defaultSessionTTL,
+		clients:  make(map[string]*clientSession),
+		verified: make(map[string]map[string]sessionClaims),
+	}
+}
+
+// purgeKey 删除由指定密钥封装的全部会话，密钥移除后这些票据需要重新解密，从而被拒绝
+func (c *sessionCache) purgeKey(kid string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.count -= len(c.verified[kid])
+	delete(c.verified, kid)
+}
+
+// SetSessionTTL 设置本服务作为调用方时新建会话的有效期，会话在剩余五分之一有效期时轮换
+func (a *Authenticator) SetSessionTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	a.sessions.mu.Lock()
+	defer a.sessions.mu.Unlock()
+	a.sessions.ttl = ttl
+}
+
+/*****************************************************************
+*							调用方
+*****************************************************************/
+
+// SetSessionHeader 为发往 audience 服务的请求写入会话请求头；同一目标的会话只在新建时做一次 RSA 加密，
+// 之后每个请求只计算 HMAC。请求头绑定方法、路径、查询参数和请求体，写入后不能再修改它们
+func (a *Authenticator) SetSessionHeader(req *http.Request, audience string, scopes ...string) error {
+	session, err := a.clientSession(audience, scopes)
+	if err != nil {
+		return err
+	}
+	a.mu.RLock()
+	maxBody := a.maxBody
+	a.mu.RUnlock()
+	digest, err := bodyDigest(req, maxBody)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+	timestamp := a.currentTime().UnixMilli()
+	mac := sessionMAC(session.claims.Key, req, digest, timestamp, nonce)
+
+	req.Header.Set(headerSession, strings.Join([]string{
+		session.ticket,
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+		base64.RawURLEncoding.EncodeToString(mac),
+	}, "."))
+	return nil
+}
+
+// SessionTransport 返回为每个请求写入会话请求头的 http.RoundTripper，base 为空时使用 http.DefaultTransport
+func (a *Authenticator) SessionTransport(base http.RoundTripper, audience string, scopes ...string) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return sessionTransport{auth: a, base: base, audience: audience, scopes: scopes}
+}
+
+type sessionTransport struct {
+	auth     *Authenticator
+	base     http.RoundTripper
+	audience string
+	scopes   []string
+}
+
+func (t sessionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// RoundTripper 不能修改调用方传入的请求
+	req = req.Clone(req.Context())
+	if err := t.auth.SetSessionHeader(req, t.audience, t.scopes...); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
+
+// clientSession 取出缓存的会话，即将过期时新建会话
+func (a *Authenticator) clientSession(audience string, scopes []string) (*clientSession, error) {
+	a.mu.RLock()
+	now, service := a.now(), a.service
+	a.mu.RUnlock()
+
+	cacheKey := audience + "\x00" + strings.Join(scopes, " ")
+	cache := a.sessions
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if session, ok := cache.clients[cacheKey]; ok && now.Before(session.refreshAt) {
+		return session, nil
+	}
+
+	id := make([]byte, 16)
+	key := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	expiration := now.Add(cache.ttl)
+	claims := sessionClaims{
+		ID:         hex.EncodeToString(id),
+		Key:        key,
+		Expiration: expiration.UnixMilli(),
+		Service:    service,
+		Audience:   audience,
+		Scopes:     scopes,
+	}
+
+	ticket, err := a.sealSessionTicket(claims)
+	if err != nil {
+		return nil, err
+	}
+	session := &clientSession{
+		ticket:     ticket,
+		claims:     claims,
+		expiration: expiration,
+		refreshAt:  expiration.Add(-cache.ttl / 5),
+	}
+	cache.clients[cacheKey] = session
+	logutil.Println("新建会话：", audience, claims.ID)
+	return session, nil
+}
+
+// sealSessionTicket 用混合加密信封封装会话内容，只有持有私钥的接收方能解出会话密钥
+func (a *Authenticator) sealSessionTicket(claims sessionClaims) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := a.EncryptAESString(string(data))
+	if err != nil {
+		return "", err
+	}
+	envelope, err := json.Marshal(encrypted)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(envelope), nil
+}
+
+// sessionMAC 会话请求头的 HMAC，覆盖方法、路径、查询参数、请求体摘要、时间戳和随机数
+func sessionMAC(key []byte, req *http.Request, digest string, timestamp int64, nonce string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(strings.Join([]string{
+		sessionMACContext,
+		strings.ToUpper(req.Method),
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		digest,
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+	}, "\n")))
+	return h.Sum(nil)
+}
+
+/*****************************************************************
+*							接收方
+*****************************************************************/
+
+func (a *Authenticator) verifySession(req *http.Request, value string) (Identity, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 4 {
+		logutil.Println("会话请求头的解析失败")
+		return Identity{}, invalidSession
+	}
+	ticket, nonce := parts[0], parts[2]
+	timestamp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || len(nonce) == 0 {
+		return Identity{}, invalidSession
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[3])
+	if err != nil {
+		return Identity{}, invalidSession
+	}
+
+	claims, err := a.openSessionTicket(ticket)
+	if err != nil {
+		logutil.Println("会话票据无法解密：", err)
+		return Identity{}, err
+	}
+
+	a.mu.RLock()
+	now, validity, maxBody := a.now(), a.validity, a.maxBody
+	a.mu.RUnlock()
+	if now.UnixMilli() > claims.Expiration {
+		logutil.Println("会话已过期：", claims.ID)
+		return Identity{}, fmt.Errorf("%w: session %s", expiredSession, claims.ID)
+	}
+	signedAt := time.UnixMilli(timestamp)
+	if now.Sub(signedAt) > validity || signedAt.Sub(now) > validity {
+		logutil.Println("会话请求头已过期")
+		return Identity{}, fmt.Errorf("%w: session %s, request signed at %s", expiredSession, claims.ID, signedAt.UTC().Format(time.RFC3339))
+	}
+
+	digest, err := bodyDigest(req, maxBody)
+	if err != nil {
+		logutil.Println("会话请求的请求体无法读取：", err)
+		return Identity{}, fmt.Errorf("%w: %v", invalidSession, err)
+	}
+	if !hmac.Equal(mac, sessionMAC(claims.Key, req, digest, timestamp, nonce)) {
+		logutil.Println("会话请求头校验失败：", claims.ID)
+		return Identity{}, fmt.Errorf("%w: session %s", unverifiedSession, claims.ID)
+	}
+
+	if err := a.checkAudience(claims.Audience); err != nil {
+		logutil.Println("会话的受众不匹配：", claims.Audience)
+		return Identity{}, err
+	}
+	if err := a.checkNonce(nonce, signedAt.Add(validity)); err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Method:  MethodSession,
+		Service: claims.Service,
+		KeyID:   claims.ID,
+		Scopes:  claims.Scopes,
+	}, nil
+}
+
+// openSessionTicket 解出会话内容；同一票据只在首次出现时做 RSA 解密，之后从缓存中读取。
+// 缓存按封装票据的密钥 ID 分组，密钥移除后对应的会话随之失效
+func (a *Authenticator) openSessionTicket(ticket string) (sessionClaims, error) {
+	envelope, err := base64.RawURLEncoding.DecodeString(ticket)
+	if err != nil {
+		return sessionClaims{}, fmt.Errorf("%w: %v", invalidSession, err)
+	}
+	var encrypted EncryptedData
+	if err := json.Unmarshal(envelope, &encrypted); err != nil {
+		return sessionClaims{}, fmt.Errorf("%w: %v", invalidSession, err)
+	}
+	if len(encrypted.KeyID) == 0 {
+		return sessionClaims{}, fmt.Errorf("%w: ticket has no key id", invalidSession)
+	}
+	sum := sha256.Sum256([]byte(ticket))
+	digest := hex.EncodeToString(sum[:])
+
+	cache := a.sessions
+	cache.mu.Lock()
+	claims, ok := cache.verified[encrypted.KeyID][digest]
+	cache.mu.Unlock()
+	if ok {
+		return claims, nil
+	}
+
+	data, err := a.DecryptAESString(encrypted)
+	if err != nil {
+		return sessionClaims{}, fmt.Errorf("%w: key %q: %v", unverifiedSession, encrypted.KeyID, err)
+	}
+	if err := json.Unmarshal([]byte(data), &claims); err != nil || len(claims.Key) == 0 {
+		return sessionClaims{}, fmt.Errorf("%w: malformed ticket", invalidSession)
+	}
+
+	now := a.currentTime().UnixMilli()
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.count >= defaultSessionCapacity {
+		for kid, sessions := range cache.verified {
+			for k, c := range sessions {
+				if c.Expiration < now {
+					delete(sessions, k)
+					cache.count--
+				}
+			}
+			if len(sessions) == 0 {
+				delete(cache.verified, kid)
+			}
+		}
+	}
+	// 清理过期会话后仍然已满时随机淘汰一个，被淘汰的会话下次出现时重新解密
+	for _, sessions := range cache.verified {
+		if cache.count < defaultSessionCapacity {
+			break
+		}
+		for k := range sessions {
+			delete(sessions, k)
+			cache.count--
+			break
+		}
+	}
+	sessions, ok := cache.verified[encrypted.KeyID]
+	if !ok {
+		sessions = make(map[string]sessionClaims)
+		cache.verified[encrypted.KeyID] = sessions
+	}
+	if _, ok := sessions[digest]; !ok {
+		cache.count++
+	}
+	sessions[digest] = claims
+	return claims, nil
+}
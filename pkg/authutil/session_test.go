@@ -0,0 +1,75 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sessionRequest 由调用方写入会话请求头，再把请求头复制到一个携带 body 的新请求上
+func sessionRequest(t *testing.T, f *authtest.Fixture, signedBody string, body string) *http.Request {
+	t.Helper()
+	signed := httptest.NewRequest(http.MethodPost, "/orders?id=1", strings.NewReader(signedBody))
+	if err := f.Client.SetSessionHeader(signed, "inventory", "orders:write"); err != nil {
+		t.Fatalf("SetSessionHeader: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/orders?id=1", strings.NewReader(body))
+	req.Header.Set(authutil.HeaderSession, signed.Header.Get(authutil.HeaderSession))
+	return req
+}
+
+func TestSession(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest, authtest.WithService("inventory"), authtest.WithCaller("order"))
+
+	w, identity := serve(t, f.Middleware(), sessionRequest(t, f, `{"qty":1}`, `{"qty":1}`))
+	if code := authtest.ResponseCode(t, w); code != 2000 {
+		t.Fatalf("code = %d, want 2000, body %s", code, w.Body.String())
+	}
+	if identity.Method != authutil.MethodSession || identity.Service != "order" || !identity.HasScope("orders:write") {
+		t.Errorf("identity = %+v", identity)
+	}
+}
+
+func TestSessionBodyIsBound(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest, authtest.WithService("inventory"))
+
+	w, _ := serve(t, f.Middleware(), sessionRequest(t, f, `{"qty":1}`, `{"qty":1000}`))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+}
+
+func TestSessionReplay(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest, authtest.WithService("inventory"))
+
+	req := sessionRequest(t, f, "", "")
+	value := req.Header.Get(authutil.HeaderSession)
+	if w, _ := serve(t, f.Middleware(), req); authtest.ResponseCode(t, w) != 2000 {
+		t.Fatalf("first use failed: %s", w.Body.String())
+	}
+	replayed := httptest.NewRequest(http.MethodPost, "/orders?id=1", nil)
+	replayed.Header.Set(authutil.HeaderSession, value)
+	w, _ := serve(t, f.Middleware(), replayed)
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthReplayed {
+		t.Errorf("code = %d, want %d", code, authutil.CodeAuthReplayed)
+	}
+}
+
+func TestSessionKeyRemoval(t *testing.T) {
+	f := newFixture(t, authutil.ProfileTest, authtest.WithService("inventory"))
+
+	// 第一次请求后票据已缓存在接收方
+	if w, _ := serve(t, f.Middleware(), sessionRequest(t, f, "", "")); authtest.ResponseCode(t, w) != 2000 {
+		t.Fatalf("first use failed: %s", w.Body.String())
+	}
+	if err := f.Server.RemoveKey(f.KeyID); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := serve(t, f.Middleware(), sessionRequest(t, f, "", ""))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("code after RemoveKey = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+}
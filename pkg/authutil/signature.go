@@ -0,0 +1,305 @@
+package authutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	headerRequestSignature = "X-LincService-Signature"
+
+	defaultMaxBodySize = int64(10) << 20 // 计算请求体摘要时默认最多读取 10MB
+)
+
+var (
+	emptySignature   = errors.New("request signature is empty")
+	invalidSignature = errors.New("invalid request signature")
+	expiredSignature = errors.New("request signature is expired")
+
+	unverifiedSignature = errors.New("request signature cannot be verified")
+)
+
+// signingKey 调用方用于签名请求的私钥
+type signingKey struct {
+	id         string
+	alg        string
+	privateKey crypto.Signer
+}
+
+// requestSignature 请求签名头部的内容，格式为 keyId=...,algorithm=...,timestamp=...,nonce=...[,service=...],signature=...
+type requestSignature struct {
+	KeyID     string
+	Algorithm string // 签名算法，为空表示 RS256
+	Timestamp int64  // 签名时间，UTC时间戳
+	Nonce     string
+	Service   string // 调用方服务名称，可选
+	Signature []byte
+}
+
+func (s requestSignature) String() string {
+	service := ""
+	if len(s.Service) > 0 {
+		service = ",service=" + s.Service
+	}
+	return fmt.Sprintf("keyId=%s,algorithm=%s,timestamp=%d,nonce=%s%s,signature=%s",
+		s.KeyID, s.Algorithm, s.Timestamp, s.Nonce, service, base64.StdEncoding.EncodeToString(s.Signature))
+}
+
+func parseRequestSignature(value string) (requestSignature, error) {
+	var sig requestSignature
+	for _, part := range strings.Split(value, ",") {
+		name, val, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return sig, invalidSignature
+		}
+		switch name {
+		case "keyId":
+			sig.KeyID = val
+		case "algorithm":
+			sig.Algorithm = val
+		case "timestamp":
+			timestamp, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return sig, invalidSignature
+			}
+			sig.Timestamp = timestamp
+		case "nonce":
+			sig.Nonce = val
+		case "service":
+			sig.Service = val
+		case "signature":
+			signature, err := base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return sig, invalidSignature
+			}
+			sig.Signature = signature
+		}
+	}
+	if len(sig.KeyID) == 0 || sig.Timestamp == 0 || len(sig.Nonce) == 0 || len(sig.Signature) == 0 {
+		return sig, invalidSignature
+	}
+	if len(sig.Algorithm) == 0 {
+		sig.Algorithm = AlgRS256
+	}
+	return sig, nil
+}
+
+// canonicalRequest 待签名的规范字符串：方法、路径、查询参数、请求体摘要、时间戳和随机数，以换行分隔；
+// 携带调用方服务名称时追加在最后，不携带时与旧版本签名保持一致
+func canonicalRequest(req *http.Request, bodyDigest string, timestamp int64, nonce string, service string) string {
+	parts := []string{
+		strings.ToUpper(req.Method),
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		bodyDigest,
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+	}
+	if len(service) > 0 {
+		parts = append(parts, service)
+	}
+	return strings.Join(parts, "\n")
+}
+
+// bodyDigest 计算请求体的 SHA-256，并把读取过的请求体放回请求中；请求体超过 limit 时返回错误，
+// 摘要在认证之前计算，不限制大小会被未认证的请求耗尽内存
+func bodyDigest(req *http.Request, limit int64) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		sum := sha256.Sum256(nil)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(nil, req.Body, limit))
+	_ = req.Body.Close()
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return "", fmt.Errorf("%w: request body exceeds %d bytes", invalidSignature, limit)
+		}
+		return "", err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SetMaxBodySize 设置请求签名和会话请求头计算请求体摘要时允许的最大请求体，默认 10MB
+func (a *Authenticator) SetMaxBodySize(size int64) {
+	if size <= 0 {
+		size = defaultMaxBodySize
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.maxBody = size
+}
+
+/*****************************************************************
+*							调用方
+*****************************************************************/
+
+// SetSigningKey 设置调用方用于签名请求的私钥，接收方需以 trusted 状态添加对应的公钥；
+// RSA 密钥使用 PS256，ECDSA P-256 密钥使用 ES256，Ed25519 密钥使用 EdDSA
+func (a *Authenticator) SetSigningKey(pemStr string) error {
+	privateKey, err := parsePrivateKeyPEM(pemStr)
+	if err != nil {
+		return err
+	}
+	alg, err := defaultSignatureAlgorithm(privateKey.Public())
+	if err != nil {
+		return err
+	}
+	id, _, err := fingerprintOf(privateKey.Public())
+	if err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.signer = &signingKey{id: id, alg: alg, privateKey: privateKey}
+	return nil
+}
+
+// SetSigningAlgorithm 修改签名算法，例如 RSA 密钥改用 RS256 以兼容只支持 RS256 的 JWT 校验方；算法必须与密钥类型匹配
+func (a *Authenticator) SetSigningAlgorithm(alg string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.signer == nil {
+		return errors.New("signing key is not set")
+	}
+	if _, err := signMessage(alg, a.signer.privateKey, nil); err != nil {
+		return err
+	}
+	a.signer = &signingKey{id: a.signer.id, alg: alg, privateKey: a.signer.privateKey}
+	return nil
+}
+
+// SignRequest 对请求的方法、路径、查询参数和请求体签名，并写入签名头部；签名后请求的任何部分都不能再修改
+func (a *Authenticator) SignRequest(req *http.Request) error {
+	a.mu.RLock()
+	signer := a.signer
+	service := a.service
+	timestamp := a.now().UnixMilli()
+	maxBody := a.maxBody
+	a.mu.RUnlock()
+
+	if signer == nil {
+		return errors.New("signing key is not set")
+	}
+
+	digest, err := bodyDigest(req, maxBody)
+	if err != nil {
+		return err
+	}
+	nonce, err := newNonce()
+	if err != nil {
+		return err
+	}
+
+	signature, err := signMessage(signer.alg, signer.privateKey, []byte(canonicalRequest(req, digest, timestamp, nonce, service)))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set(headerRequestSignature, requestSignature{
+		KeyID:     signer.id,
+		Algorithm: signer.alg,
+		Timestamp: timestamp,
+		Nonce:     nonce,
+		Service:   service,
+		Signature: signature,
+	}.String())
+	return nil
+}
+
+/*****************************************************************
+*							接收方
+*****************************************************************/
+
+// VerifySignedRequest 仅接受携带有效请求签名的请求
+func (a *Authenticator) VerifySignedRequest(req *http.Request) error {
+	_, err := a.AuthenticateSignedRequest(req)
+	return err
+}
+
+// AuthenticateSignedRequest 仅接受携带有效请求签名的请求，并返回调用方身份
+func (a *Authenticator) AuthenticateSignedRequest(req *http.Request) (Identity, error) {
+	identity, err := a.verifySignature(req)
+	return identity, a.count(err)
+}
+
+func (a *Authenticator) verifySignature(req *http.Request) (Identity, error) {
+	value := req.Header.Get(headerRequestSignature)
+	if len(value) == 0 {
+		logutil.Println("请求签名不存在")
+		return Identity{}, emptySignature
+	}
+
+	sig, err := parseRequestSignature(value)
+	if err != nil {
+		logutil.Println("请求签名的解析失败")
+		return Identity{}, err
+	}
+
+	// 签名时间允许双向偏差一个有效期，以容忍调用方和接收方的时钟误差
+	a.mu.RLock()
+	now, validity, maxBody := a.now(), a.validity, a.maxBody
+	a.mu.RUnlock()
+	signedAt := time.UnixMilli(sig.Timestamp)
+	if now.Sub(signedAt) > validity || signedAt.Sub(now) > validity {
+		logutil.Println("请求签名已过期")
+		return Identity{}, expiredSignature
+	}
+
+	key, err := a.keys.verifyingKey(sig.KeyID)
+	if err != nil {
+		logutil.Println("请求签名的密钥未知或已退役：", sig.KeyID)
+		return Identity{}, fmt.Errorf("%w: key %q: %v", unverifiedSignature, sig.KeyID, err)
+	}
+	// 绑定了服务名称的密钥只能以该名称签名，防止持有其他密钥的调用方冒充
+	if len(key.service) > 0 && sig.Service != key.service {
+		logutil.Println("请求签名的服务名称与密钥不符：", sig.KeyID, sig.Service)
+		return Identity{}, fmt.Errorf("%w: key %q is bound to service %q, got %q", unverifiedSignature, sig.KeyID, key.service, sig.Service)
+	}
+
+	digest, err := bodyDigest(req, maxBody)
+	if err != nil {
+		return Identity{}, err
+	}
+	message := []byte(canonicalRequest(req, digest, sig.Timestamp, sig.Nonce, sig.Service))
+	if err := verifyMessage(sig.Algorithm, key.publicKey, message, sig.Signature); err != nil {
+		logutil.Println("请求签名校验失败")
+		return Identity{}, fmt.Errorf("%w: key %q, %s: %v", unverifiedSignature, sig.KeyID, sig.Algorithm, err)
+	}
+
+	if err := a.checkNonce(sig.Nonce, signedAt.Add(validity)); err != nil {
+		return Identity{}, err
+	}
+
+	// 未绑定服务名称的密钥无法证明调用方是谁，不采信自报的服务名称
+	service := sig.Service
+	if len(key.service) == 0 && len(service) > 0 {
+		logutil.Println("请求签名的密钥未绑定服务名称，忽略自报的服务名称：", sig.KeyID, service)
+		service = ""
+	}
+	return Identity{
+		Method:  MethodSignature,
+		Service: service,
+		KeyID:   sig.KeyID,
+	}, nil
+}
@@ -0,0 +1,164 @@
+package authutil_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ed25519Keys 生成调用方用于签名的 Ed25519 密钥对
+func ed25519Keys(t *testing.T) (string, string) {
+	t.Helper()
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+}
+
+// newSigner 创建以 service 名义签名的调用方，接收方以 bind 为空时的 trusted 状态或绑定到 bind 的方式信任其公钥
+func newSigner(t *testing.T, f *authtest.Fixture, service string, bind string) *authutil.Authenticator {
+	t.Helper()
+	privatePEM, publicPEM := ed25519Keys(t)
+	signer := authutil.NewAuthenticator()
+	signer.SetServiceName(service)
+	if err := signer.SetSigningKey(privatePEM); err != nil {
+		t.Fatalf("SetSigningKey: %v", err)
+	}
+
+	var err error
+	if len(bind) > 0 {
+		_, err = f.Server.AddServiceKey(publicPEM, bind)
+	} else {
+		_, err = f.Server.AddKey(publicPEM, authutil.KeyStateTrusted)
+	}
+	if err != nil {
+		t.Fatalf("trust signing key: %v", err)
+	}
+	return signer
+}
+
+func signedRequest(t *testing.T, signer *authutil.Authenticator, target string, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	if err := signer.SignRequest(req); err != nil {
+		t.Fatalf("SignRequest: %v", err)
+	}
+	return req
+}
+
+func TestSignedRequest(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	signer := newSigner(t, f, "billing", "billing")
+
+	w, identity := serve(t, f.Middleware(), signedRequest(t, signer, "/orders?id=1", `{"amount":1}`))
+	if w.Code != http.StatusOK || identity.Method != authutil.MethodSignature || identity.Service != "billing" {
+		t.Fatalf("status = %d, identity = %+v, body = %s", w.Code, identity, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(req *http.Request)
+	}{
+		{"body", func(req *http.Request) {
+			req.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"amount":100}`)).Body
+		}},
+		{"query", func(req *http.Request) { req.URL.RawQuery = "id=2" }},
+		{"path", func(req *http.Request) { req.URL.Path = "/refunds" }},
+		{"method", func(req *http.Request) { req.Method = http.MethodDelete }},
+	}
+	for _, tt := range tests {
+		t.Run("tampered "+tt.name, func(t *testing.T) {
+			req := signedRequest(t, signer, "/orders?id=1", `{"amount":1}`)
+			tt.tamper(req)
+			w, _ := serve(t, f.Middleware(), req)
+			if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+				t.Errorf("code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+			}
+		})
+	}
+}
+
+func TestSignedRequestReplay(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	signer := newSigner(t, f, "billing", "billing")
+
+	req := signedRequest(t, signer, "/orders", "")
+	value := req.Header.Get("X-LincService-Signature")
+	if w, _ := serve(t, f.Middleware(), req); w.Code != http.StatusOK {
+		t.Fatalf("first request: %s", w.Body.String())
+	}
+	replay := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	replay.Header.Set("X-LincService-Signature", value)
+	w, _ := serve(t, f.Middleware(), replay)
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthReplayed {
+		t.Errorf("replay: code = %d, want %d", code, authutil.CodeAuthReplayed)
+	}
+}
+
+func TestSignedRequestBodyLimit(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	f.Server.SetMaxBodySize(16)
+	signer := newSigner(t, f, "billing", "billing")
+
+	w, _ := serve(t, f.Middleware(), signedRequest(t, signer, "/orders", strings.Repeat("x", 17)))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthMalformed {
+		t.Errorf("oversized body: code = %d, want %d", code, authutil.CodeAuthMalformed)
+	}
+	if w, _ := serve(t, f.Middleware(), signedRequest(t, signer, "/orders", strings.Repeat("x", 16))); w.Code != http.StatusOK {
+		t.Errorf("body at limit: %s", w.Body.String())
+	}
+}
+
+func TestSignedRequestServiceBinding(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+
+	// 绑定到 billing 的密钥不能以其他服务的名义签名
+	impostor := newSigner(t, f, "payments", "billing")
+	w, _ := serve(t, f.Middleware(), signedRequest(t, impostor, "/orders", ""))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("wrong service: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+
+	// 未绑定的密钥可以通过校验，但自报的服务名称不被采信
+	unbound := newSigner(t, f, "payments", "")
+	w, identity := serve(t, f.Middleware(), signedRequest(t, unbound, "/orders", ""))
+	if w.Code != http.StatusOK || identity.Service != "" {
+		t.Errorf("unbound key: status = %d, identity = %+v", w.Code, identity)
+	}
+}
+
+func TestSignedRequestRetiredKey(t *testing.T) {
+	f := newFixture(t, authutil.ProfileDev)
+	signer := newSigner(t, f, "billing", "billing")
+
+	var keyID string
+	for _, key := range f.Server.Keys() {
+		if key.Service == "billing" {
+			keyID = key.ID
+		}
+	}
+	if err := f.Server.SetKeyState(keyID, authutil.KeyStateRetiring); err != nil {
+		t.Fatalf("SetKeyState: %v", err)
+	}
+	w, _ := serve(t, f.Middleware(), signedRequest(t, signer, "/orders", ""))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("retiring key: code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+}
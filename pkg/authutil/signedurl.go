@@ -0,0 +1,211 @@
+package authutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SignedURLParam 签名 URL 中携带签名的查询参数
+const SignedURLParam = "lsig"
+
+var (
+	emptySignedURL      = errors.New("url signature is empty")
+	invalidSignedURL    = errors.New("invalid url signature")
+	unverifiedSignedURL = errors.New("url signature cannot be verified")
+	expiredSignedURL    = errors.New("signed url is expired")
+)
+
+// signedURLHeader 签名参数的头部，与签名一起以 base64url 编码，格式为 <头部>.<签名>
+type signedURLHeader struct {
+	KeyID      string   `json:"kid"`
+	Algorithm  string   `json:"alg"`
+	Expiration int64    `json:"exp"`           // 过期时间，UTC时间戳（秒）
+	Query      []string `json:"q,omitempty"`   // 签名覆盖的查询参数名称
+	Nonce      string   `json:"n,omitempty"`   // 只能使用一次的链接带有随机数
+	Service    string   `json:"svc,omitempty"` // 签发方服务名称
+}
+
+// SignURLOption 签名 URL 的可选项
+type SignURLOption func(*signedURLHeader) error
+
+// SingleUse 签名 URL 只能成功使用一次，多进程部署时需要共享随机数存储
+func SingleUse() SignURLOption {
+	return func(header *signedURLHeader) error {
+		nonce, err := newNonce()
+		if err != nil {
+			return err
+		}
+		header.Nonce = nonce
+		return nil
+	}
+}
+
+// SignURL 使用签名私钥为 rawURL 签名，签名覆盖方法、路径、过期时间和 URL 中已有的全部查询参数；
+// 校验时不允许增加、删除或修改这些参数
+func (a *Authenticator) SignURL(method string, rawURL string, ttl time.Duration, opts ...SignURLOption) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	if _, ok := query[SignedURLParam]; ok {
+		return "", fmt.Errorf("url already has a %s parameter", SignedURLParam)
+	}
+
+	a.mu.RLock()
+	signer := a.signer
+	now, service := a.now(), a.service
+	a.mu.RUnlock()
+	if signer == nil {
+		return "", errors.New("signing key is not set")
+	}
+
+	header := signedURLHeader{
+		KeyID:      signer.id,
+		Algorithm:  signer.alg,
+		Expiration: now.Add(ttl).Unix(),
+		Service:    service,
+	}
+	for name := range query {
+		header.Query = append(header.Query, name)
+	}
+	sort.Strings(header.Query)
+	for _, opt := range opts {
+		if err := opt(&header); err != nil {
+			return "", err
+		}
+	}
+
+	headerBytes, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(headerBytes)
+	signature, err := signMessage(signer.alg, signer.privateKey, []byte(canonicalURL(method, u.EscapedPath(), query, encodedHeader)))
+	if err != nil {
+		return "", err
+	}
+
+	query.Set(SignedURLParam, encodedHeader+"."+base64.RawURLEncoding.EncodeToString(signature))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// canonicalURL 待签名的规范字符串：方法、路径、排序后的查询参数和签名头部，以换行分隔
+func canonicalURL(method string, escapedPath string, query url.Values, encodedHeader string) string {
+	return strings.Join([]string{
+		"LSU1",
+		strings.ToUpper(method),
+		escapedPath,
+		query.Encode(),
+		encodedHeader,
+	}, "\n")
+}
+
+// VerifySignedURL 校验请求 URL 的签名，HEAD 请求可以使用为 GET 签名的 URL
+func (a *Authenticator) VerifySignedURL(req *http.Request) (Identity, error) {
+	identity, err := a.verifySignedURL(req)
+	return identity, a.count(err)
+}
+
+func (a *Authenticator) verifySignedURL(req *http.Request) (Identity, error) {
+	query := req.URL.Query()
+	value := query.Get(SignedURLParam)
+	if len(value) == 0 {
+		return Identity{}, emptySignedURL
+	}
+	query.Del(SignedURLParam)
+
+	encodedHeader, encodedSignature, ok := strings.Cut(value, ".")
+	if !ok {
+		return Identity{}, invalidSignedURL
+	}
+	headerBytes, err := base64.RawURLEncoding.DecodeString(encodedHeader)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", invalidSignedURL, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: %v", invalidSignedURL, err)
+	}
+	var header signedURLHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil || len(header.KeyID) == 0 || header.Expiration == 0 {
+		return Identity{}, invalidSignedURL
+	}
+
+	// 查询参数必须与签名时完全一致，防止借用签名访问其他资源
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if strings.Join(names, "&") != strings.Join(header.Query, "&") {
+		logutil.Println("签名 URL 的查询参数与签名时不一致")
+		return Identity{}, fmt.Errorf("%w: query parameters do not match", unverifiedSignedURL)
+	}
+
+	// 只接受活跃和受信任的密钥，退役中的密钥签发的链接随轮换失效
+	key, err := a.keys.verifyingKey(header.KeyID)
+	if err != nil {
+		logutil.Println("签名 URL 的密钥不可用：", header.KeyID, err)
+		return Identity{}, fmt.Errorf("%w: key %q: %v", unverifiedSignedURL, header.KeyID, err)
+	}
+
+	verified := false
+	for _, method := range signedURLMethods(req.Method) {
+		message := []byte(canonicalURL(method, req.URL.EscapedPath(), query, encodedHeader))
+		if verifyMessage(header.Algorithm, key.publicKey, message, signature) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		logutil.Println("签名 URL 校验失败")
+		return Identity{}, fmt.Errorf("%w: key %q, %s", unverifiedSignedURL, header.KeyID, header.Algorithm)
+	}
+
+	expiration := time.Unix(header.Expiration, 0)
+	if now := a.currentTime(); now.After(expiration) {
+		logutil.Println("签名 URL 已过期")
+		return Identity{}, fmt.Errorf("%w: expired %s ago", expiredSignedURL, now.Sub(expiration).Round(time.Second))
+	}
+
+	if err := a.checkNonce(header.Nonce, expiration); err != nil {
+		return Identity{}, err
+	}
+
+	return Identity{
+		Method:  MethodSignedURL,
+		Service: header.Service,
+		KeyID:   header.KeyID,
+	}, nil
+}
+
+func signedURLMethods(method string) []string {
+	if method == http.MethodHead {
+		return []string{http.MethodHead, http.MethodGet}
+	}
+	return []string{method}
+}
+
+// SignedURLAuth 只接受有效签名 URL 的中间件，用于下载和分享链接
+func (a *Authenticator) SignedURLAuth() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		identity, err := a.VerifySignedURL(ctx.Request)
+		if err != nil {
+			a.abortWithFailure(ctx, err)
+			return
+		}
+		SetIdentity(ctx, identity)
+		ctx.Next()
+	}
+}
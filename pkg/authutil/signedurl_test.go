@@ -0,0 +1,87 @@
+package authutil_test
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil/authtest"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signedURLFixture(t *testing.T) *authtest.Fixture {
+	t.Helper()
+	f := newFixture(t, authutil.ProfileTest)
+	if err := f.Server.SetSigningKey(f.PrivateKeyPEM); err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestSignedURL(t *testing.T) {
+	f := signedURLFixture(t)
+	signed, err := f.Server.SignURL(http.MethodGet, "/files/report.pdf?inline=1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		code   int
+	}{
+		{"valid", http.MethodGet, signed, 2000},
+		{"head", http.MethodHead, signed, 2000},
+		{"other method", http.MethodDelete, signed, authutil.CodeAuthUndecryptable},
+		{"other path", http.MethodGet, strings.Replace(signed, "report.pdf", "salary.pdf", 1), authutil.CodeAuthUndecryptable},
+		{"added parameter", http.MethodGet, signed + "&download=1", authutil.CodeAuthUndecryptable},
+		{"missing", http.MethodGet, "/files/report.pdf?inline=1", authutil.CodeAuthEmpty},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, identity := serve(t, f.Server.SignedURLAuth(), httptest.NewRequest(tt.method, tt.target, nil))
+			if tt.method == http.MethodHead {
+				// HEAD 没有返回体，只检查状态码和身份
+				if w.Code != http.StatusOK || identity.Method != authutil.MethodSignedURL {
+					t.Errorf("status = %d, identity = %+v", w.Code, identity)
+				}
+				return
+			}
+			if code := authtest.ResponseCode(t, w); code != tt.code {
+				t.Errorf("code = %d, want %d, body %s", code, tt.code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestSignedURLExpired(t *testing.T) {
+	f := signedURLFixture(t)
+	signed, err := f.Server.SignURL(http.MethodGet, "/files/report.pdf", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Server.SetClock(func() time.Time { return time.Now().Add(time.Hour) })
+
+	w, _ := serve(t, f.Server.SignedURLAuth(), httptest.NewRequest(http.MethodGet, signed, nil))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthExpired {
+		t.Errorf("code = %d, want %d", code, authutil.CodeAuthExpired)
+	}
+}
+
+func TestSignedURLRetiringKey(t *testing.T) {
+	f := signedURLFixture(t)
+	signed, err := f.Server.SignURL(http.MethodGet, "/files/report.pdf", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Server.SetKeyState(f.KeyID, authutil.KeyStateRetiring); err != nil {
+		t.Fatal(err)
+	}
+
+	w, _ := serve(t, f.Server.SignedURLAuth(), httptest.NewRequest(http.MethodGet, signed, nil))
+	if code := authtest.ResponseCode(t, w); code != authutil.CodeAuthUndecryptable {
+		t.Errorf("code = %d, want %d", code, authutil.CodeAuthUndecryptable)
+	}
+}
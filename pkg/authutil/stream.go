@@ -0,0 +1,361 @@
+package authutil
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// 流式加密的格式：
+//
+//	magic(4) | 头部长度(2) | 头部 JSON | 块...
+//	块：密文长度(4) | AES-GCM 密文
+//
+// 每块的 nonce 为 7 字节随机前缀 + 4 字节块序号 + 1 字节末块标记，附加数据为完整头部，
+// 因此块被篡改、调换顺序、删除或在末块之后截断都无法通过校验
+const (
+	streamMagic            = "LSE1"
+	defaultStreamChunkSize = 64 << 10
+	maxStreamChunkSize     = 16 << 20
+	streamNoncePrefixSize  = 7
+	maxStreamHeaderSize    = 8 << 10
+)
+
+var (
+	errStreamTruncated = errors.New("encrypted stream is truncated")
+	errStreamCorrupted = errors.New("encrypted stream is corrupted")
+)
+
+// streamHeader 流式加密的头部，数据密钥用 RSA 封装
+type streamHeader struct {
+	Alg         string `json:"alg"`
+	KeyID       string `json:"kid,omitempty"`
+	Key         string `json:"key"`
+	ChunkSize   int    `json:"chunkSize"`
+	NoncePrefix string `json:"noncePrefix"`
+}
+
+func streamNonce(prefix []byte, seq uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamNoncePrefixSize:], seq)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+/*****************************************************************
+*							加密
+*****************************************************************/
+
+type encryptWriter struct {
+	w      io.Writer
+	gcm    cipher.AEAD
+	aad    []byte
+	prefix []byte
+	buf    []byte
+	n      int
+	seq    uint32
+	closed bool
+	err    error
+}
+
+// NewEncryptWriter 返回加密写入器，写入的数据按块加密后写入 w；必须调用 Close 写出末块，否则解密方会判定为截断
+func (a *Authenticator) NewEncryptWriter(w io.Writer) (io.WriteCloser, error) {
+	dataKey := make([]byte, aesKeyLength)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, streamNoncePrefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	alg, keyID, wrapped, err := a.encryptRSA(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := json.Marshal(streamHeader{
+		Alg:         alg,
+		KeyID:       keyID,
+		Key:         base64.StdEncoding.EncodeToString(wrapped),
+		ChunkSize:   defaultStreamChunkSize,
+		NoncePrefix: base64.StdEncoding.EncodeToString(prefix),
+	})
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	preamble := make([]byte, 0, len(streamMagic)+2+len(header))
+	preamble = append(preamble, streamMagic...)
+	preamble = binary.BigEndian.AppendUint16(preamble, uint16(len(header)))
+	preamble = append(preamble, header...)
+	if _, err := w.Write(preamble); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		gcm:    gcm,
+		aad:    preamble,
+		prefix: prefix,
+		buf:    make([]byte, defaultStreamChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	written := 0
+	for len(p) > 0 {
+		if e.err != nil {
+			return written, e.err
+		}
+		// 缓冲区满且还有数据时才写出，保证最后一块留到 Close 时带上末块标记
+		if e.n == len(e.buf) {
+			e.err = e.flush(false)
+			continue
+		}
+		copied := copy(e.buf[e.n:], p)
+		e.n += copied
+		written += copied
+		p = p[copied:]
+	}
+	return written, e.err
+}
+
+func (e *encryptWriter) flush(last bool) error {
+	if e.seq == ^uint32(0) {
+		return errors.New("encrypted stream is too long")
+	}
+	sealed := e.gcm.Seal(nil, streamNonce(e.prefix, e.seq, last), e.buf[:e.n], e.aad)
+	e.seq++
+	e.n = 0
+
+	var size [4]byte
+	binary.BigEndian.PutUint32(size[:], uint32(len(sealed)))
+	if _, err := e.w.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// Close 写出带末块标记的最后一块，不关闭底层写入器
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+	if e.err != nil {
+		return e.err
+	}
+	e.err = e.flush(true)
+	return e.err
+}
+
+/*****************************************************************
+*							解密
+*****************************************************************/
+
+type decryptReader struct {
+	r         io.Reader
+	gcm       cipher.AEAD
+	aad       []byte
+	prefix    []byte
+	chunkSize int
+	plain     []byte
+	seq       uint32
+	done      bool
+	err       error
+}
+
+// NewDecryptReader 返回解密读取器。每块在返回前都已通过校验，但截断只能在读到结尾时发现，
+// 因此在 Read 返回 io.EOF 之前，已读出的数据都不应视为完整
+func (a *Authenticator) NewDecryptReader(r io.Reader) (io.Reader, error) {
+	preamble := make([]byte, len(streamMagic)+2)
+	if _, err := io.ReadFull(r, preamble); err != nil {
+		return nil, fmt.Errorf("%w: %v", errStreamCorrupted, err)
+	}
+	if string(preamble[:len(streamMagic)]) != streamMagic {
+		return nil, fmt.Errorf("%w: bad magic", errStreamCorrupted)
+	}
+	headerSize := int(binary.BigEndian.Uint16(preamble[len(streamMagic):]))
+	if headerSize > maxStreamHeaderSize {
+		return nil, fmt.Errorf("%w: header is too large", errStreamCorrupted)
+	}
+	headerBytes := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, headerBytes); err != nil {
+		return nil, fmt.Errorf("%w: %v", errStreamCorrupted, err)
+	}
+
+	var header streamHeader
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, fmt.Errorf("%w: %v", errStreamCorrupted, err)
+	}
+	if header.ChunkSize <= 0 || header.ChunkSize > maxStreamChunkSize {
+		return nil, fmt.Errorf("%w: invalid chunk size %d", errStreamCorrupted, header.ChunkSize)
+	}
+	prefix, err := base64.StdEncoding.DecodeString(header.NoncePrefix)
+	if err != nil || len(prefix) != streamNoncePrefixSize {
+		return nil, fmt.Errorf("%w: invalid nonce prefix", errStreamCorrupted)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(header.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errStreamCorrupted, err)
+	}
+	dataKey, err := a.decryptRSA(wrapped, header.KeyID, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		r:         r,
+		gcm:       gcm,
+		aad:       append(preamble, headerBytes...),
+		prefix:    prefix,
+		chunkSize: header.ChunkSize,
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.done {
+			// 末块之后不允许再有数据
+			var extra [1]byte
+			if n, _ := d.r.Read(extra[:]); n > 0 {
+				d.err = fmt.Errorf("%w: data after final chunk", errStreamCorrupted)
+				return 0, d.err
+			}
+			d.err = io.EOF
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// next 读取并校验下一块；先按普通块校验，失败再按末块校验
+func (d *decryptReader) next() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return errStreamTruncated
+		}
+		return err
+	}
+	sealedSize := int(binary.BigEndian.Uint32(size[:]))
+	if sealedSize < d.gcm.Overhead() || sealedSize > d.chunkSize+d.gcm.Overhead() {
+		return fmt.Errorf("%w: invalid chunk length %d", errStreamCorrupted, sealedSize)
+	}
+	sealed := make([]byte, sealedSize)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return errStreamTruncated
+		}
+		return err
+	}
+
+	// 校验失败时 Open 会清空输出，不能与密文共用缓冲区
+	plain, err := d.gcm.Open(nil, streamNonce(d.prefix, d.seq, false), sealed, d.aad)
+	if err != nil {
+		plain, err = d.gcm.Open(nil, streamNonce(d.prefix, d.seq, true), sealed, d.aad)
+		if err != nil {
+			return fmt.Errorf("%w: chunk %d failed authentication", errStreamCorrupted, d.seq)
+		}
+		d.done = true
+	}
+	d.seq++
+	d.plain = plain
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/*****************************************************************
+*							文件
+*****************************************************************/
+
+// EncryptFile 加密文件，先写入临时文件再重命名
+func (a *Authenticator) EncryptFile(src string, dst string) error {
+	return a.transformFile(src, dst, func(in io.Reader, out io.Writer) error {
+		w, err := a.NewEncryptWriter(out)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, in); err != nil {
+			return err
+		}
+		return w.Close()
+	})
+}
+
+// DecryptFile 解密文件，整个文件通过校验后才重命名为 dst，不会留下被截断或篡改的明文
+func (a *Authenticator) DecryptFile(src string, dst string) error {
+	return a.transformFile(src, dst, func(in io.Reader, out io.Writer) error {
+		r, err := a.NewDecryptReader(in)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, r)
+		return err
+	})
+}
+
+func (a *Authenticator) transformFile(src string, dst string, transform func(io.Reader, io.Writer) error) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	out := bufio.NewWriter(tmp)
+	if err := transform(bufio.NewReader(in), out); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
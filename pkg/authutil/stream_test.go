@@ -0,0 +1,110 @@
+package authutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+)
+
+// encryptStream 用临时密钥加密 plain，返回密文和持有私钥的认证器
+func encryptStream(t *testing.T, plain []byte, close bool) ([]byte, *Authenticator) {
+	t.Helper()
+	private, _, err := GenerateRSAKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewAuthenticator()
+	if _, err := a.AddKey(private, KeyStateActive); err != nil {
+		t.Fatal(err)
+	}
+
+	var sealed bytes.Buffer
+	w, err := a.NewEncryptWriter(&sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatal(err)
+	}
+	if close {
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return sealed.Bytes(), a
+}
+
+func decryptStream(a *Authenticator, sealed []byte) ([]byte, error) {
+	r, err := a.NewDecryptReader(bytes.NewReader(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestStreamRoundTrip(t *testing.T) {
+	plain := make([]byte, 3*defaultStreamChunkSize+100)
+	_, _ = rand.Read(plain)
+	sealed, a := encryptStream(t, plain, true)
+
+	got, err := decryptStream(a, sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Error("decrypted data does not match")
+	}
+}
+
+func TestStreamTruncation(t *testing.T) {
+	plain := make([]byte, 3*defaultStreamChunkSize+100)
+	_, _ = rand.Read(plain)
+	sealed, a := encryptStream(t, plain, true)
+
+	const overhead = 4 + 16 // 块长度和 GCM 标签
+	lastChunk := overhead + 100
+	fullChunk := overhead + defaultStreamChunkSize
+
+	tests := []struct {
+		name   string
+		sealed []byte
+		want   error
+	}{
+		{"final chunk dropped", sealed[:len(sealed)-lastChunk], errStreamTruncated},
+		{"cut inside final chunk", sealed[:len(sealed)-10], errStreamTruncated},
+		{"cut inside chunk length", sealed[:len(sealed)-lastChunk+2], errStreamTruncated},
+		{"middle chunk dropped", append(append([]byte(nil), sealed[:len(sealed)-lastChunk-fullChunk]...), sealed[len(sealed)-lastChunk:]...), errStreamCorrupted},
+		{"data after final chunk", append(append([]byte(nil), sealed...), 0), errStreamCorrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decryptStream(a, tt.sealed)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamWithoutClose(t *testing.T) {
+	plain := make([]byte, 2*defaultStreamChunkSize+1)
+	_, _ = rand.Read(plain)
+	sealed, a := encryptStream(t, plain, false)
+
+	if _, err := decryptStream(a, sealed); !errors.Is(err, errStreamTruncated) {
+		t.Errorf("err = %v, want %v", err, errStreamTruncated)
+	}
+}
+
+func TestStreamTampered(t *testing.T) {
+	plain := make([]byte, 2*defaultStreamChunkSize)
+	_, _ = rand.Read(plain)
+	sealed, a := encryptStream(t, plain, true)
+	sealed[len(sealed)/2] ^= 0xff
+
+	if _, err := decryptStream(a, sealed); !errors.Is(err, errStreamCorrupted) {
+		t.Errorf("err = %v, want %v", err, errStreamCorrupted)
+	}
+}
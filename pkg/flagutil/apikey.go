@@ -0,0 +1,73 @@
+package flagutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"strings"
+	"time"
+)
+
+const apiKeyUsage = "usage: linc -apikey list | linc -apikey create [-scope a,b] [-expires 720h] <name> | linc -apikey revoke <id>"
+
+// runAPIKeyCommand 管理数据目录中的 API Key，创建时完整密钥只打印一次
+func runAPIKeyCommand(command string, args []string, scopes string, expires time.Duration) error {
+	store, err := authutil.NewAPIKeyStore(authutil.DefaultAPIKeyFile())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch command {
+	case "list":
+		list, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, key := range list {
+			status := "active"
+			switch {
+			case key.RevokedAt != 0:
+				status = "revoked"
+			case key.ExpiresAt != 0 && time.Now().UnixMilli() > key.ExpiresAt:
+				status = "expired"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\tlast used %s\n", key.ID, key.Name, status, strings.Join(key.Scopes, ","), formatMillis(key.LastUsedAt))
+		}
+	case "create":
+		if len(args) == 0 {
+			return errors.New(apiKeyUsage)
+		}
+		var scopeList []string
+		for _, scope := range strings.Split(scopes, ",") {
+			if scope = strings.TrimSpace(scope); len(scope) > 0 {
+				scopeList = append(scopeList, scope)
+			}
+		}
+		key, secret, err := store.Create(args[0], scopeList, expires)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Key ID: ", key.ID)
+		fmt.Println("API key:", secret)
+		fmt.Println("The API key is shown only once; store it securely.")
+	case "revoke":
+		if len(args) == 0 {
+			return errors.New(apiKeyUsage)
+		}
+		if _, err := store.Revoke(args[0]); err != nil {
+			return err
+		}
+		fmt.Println("Revoked", args[0])
+	default:
+		return errors.New(apiKeyUsage)
+	}
+	return nil
+}
+
+func formatMillis(millis int64) string {
+	if millis == 0 {
+		return "never"
+	}
+	return time.UnixMilli(millis).UTC().Format(time.RFC3339)
+}
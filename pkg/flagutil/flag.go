@@ -5,10 +5,19 @@ import (
 	"fmt"
 	"github.com/atmshang/nuclear-nest/pkg/versionutil"
 	"os"
+	"time"
 )
 
-// ParseFlags 解析命令行参数并执行相应的操作
+// ToolCommand 运维工具的子命令名称，工具参数注册在独立的 FlagSet 上，不会与宿主程序的参数冲突
+const ToolCommand = "linc"
+
+// ParseFlags 解析命令行参数并执行相应的操作；第一个参数为 linc 时执行运维工具并退出
 func ParseFlags() {
+	if len(os.Args) > 1 && os.Args[1] == ToolCommand {
+		runTool(os.Args[2:])
+		os.Exit(0)
+	}
+
 	// 定义版本信息的命令行参数
 	versionFlag := flag.Bool("v", false, "print version information")
 
@@ -41,3 +50,77 @@ func ParseFlags() {
 		os.Exit(0)
 	}
 }
+
+// runTool 解析 linc 子命令的参数并执行相应的操作
+func runTool(args []string) {
+	fs := flag.NewFlagSet(os.Args[0]+" "+ToolCommand, flag.ExitOnError)
+
+	// 定义密钥管理的命令行参数
+	keyGenFlag := fs.Bool("keygen", false, "generate an RSA key pair into the data dir")
+	keyBitsFlag := fs.Int("keybits", 3072, "RSA key size for -keygen")
+	keyForceFlag := fs.Bool("keyforce", false, "overwrite existing key files for -keygen")
+	fingerprintFlag := fs.Bool("fingerprint", false, "print fingerprints of key files given as arguments, or of the data dir keys")
+	keyCheckFlag := fs.Bool("keycheck", false, "check that the data dir public and private keys match")
+	authHeaderFlag := fs.Bool("authheader", false, "print a curl command with a test auth header")
+	audienceFlag := fs.String("aud", "", "audience for -authheader")
+	ttlFlag := fs.Duration("ttl", time.Minute, "validity for -authheader")
+
+	// 定义文件加解密的命令行参数
+	encryptFlag := fs.String("encrypt", "", "encrypt a file with the data dir public key")
+	decryptFlag := fs.String("decrypt", "", "decrypt a file with the data dir private key")
+	outFlag := fs.String("out", "", "output file for -encrypt and -decrypt")
+
+	// 定义机密管理的命令行参数
+	secretFlag := fs.String("secret", "", "manage the data dir secret store: list, get, put, delete, versions or rollback")
+
+	// 定义 API Key 管理的命令行参数
+	apiKeyFlag := fs.String("apikey", "", "manage data dir API keys: list, create or revoke")
+	scopeFlag := fs.String("scope", "", "comma-separated scopes for -apikey create")
+	expiresFlag := fs.Duration("expires", 0, "validity for -apikey create, 0 means no expiry")
+
+	_ = fs.Parse(args)
+
+	switch {
+	// 生成密钥对
+	case *keyGenFlag:
+		exitOnError(generateKeys(*keyBitsFlag, *keyForceFlag))
+
+	// 打印密钥指纹
+	case *fingerprintFlag:
+		exitOnError(printFingerprints(fs.Args()))
+
+	// 检查密钥对
+	case *keyCheckFlag:
+		exitOnError(checkKeyPair())
+		fmt.Println("Public key matches private key.")
+
+	// 打印测试用的请求头
+	case *authHeaderFlag:
+		exitOnError(printAuthHeader(*audienceFlag, *ttlFlag))
+
+	// 加密或解密文件
+	case len(*encryptFlag) > 0:
+		exitOnError(transformFile(*encryptFlag, *outFlag, true))
+	case len(*decryptFlag) > 0:
+		exitOnError(transformFile(*decryptFlag, *outFlag, false))
+
+	// 操作机密存储
+	case len(*secretFlag) > 0:
+		exitOnError(runSecretCommand(*secretFlag, fs.Args()))
+
+	// 管理 API Key
+	case len(*apiKeyFlag) > 0:
+		exitOnError(runAPIKeyCommand(*apiKeyFlag, fs.Args(), *scopeFlag, *expiresFlag))
+
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
+
+func exitOnError(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,110 @@
+package flagutil
+
+import (
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// generateKeys 在数据目录的 keys 文件夹中生成 RSA 密钥对
+func generateKeys(bits int, overwrite bool) error {
+	privatePEM, publicPEM, err := authutil.GenerateRSAKeyPair(bits)
+	if err != nil {
+		return err
+	}
+	files := authutil.DefaultKeyFiles()
+	if err := authutil.WriteKeyFiles(files, privatePEM, publicPEM, overwrite); err != nil {
+		return err
+	}
+	info, err := authutil.InspectKeyPEM(publicPEM)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Private key:", files.PrivateKey)
+	fmt.Println("Public key: ", files.PublicKey)
+	fmt.Println("Key ID:     ", info.ID)
+	return nil
+}
+
+// printFingerprints 打印密钥文件的密钥 ID 和指纹，未指定文件时打印默认密钥文件
+func printFingerprints(paths []string) error {
+	if len(paths) == 0 {
+		files := authutil.DefaultKeyFiles()
+		paths = []string{files.PublicKey, files.PrivateKey}
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := authutil.InspectKeyPEM(string(data))
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		kind := "public"
+		if info.HasPrivateKey {
+			kind = "private"
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\t%s\n", path, kind, info.Algorithm, info.ID, info.Fingerprint)
+	}
+	return nil
+}
+
+// checkKeyPair 检查默认密钥文件中的公钥与私钥是否匹配
+func checkKeyPair() error {
+	files := authutil.DefaultKeyFiles()
+	publicPEM, err := os.ReadFile(files.PublicKey)
+	if err != nil {
+		return err
+	}
+	privatePEM, err := os.ReadFile(files.PrivateKey)
+	if err != nil {
+		return err
+	}
+	return authutil.CheckKeyPair(string(publicPEM), string(privatePEM))
+}
+
+// printAuthHeader 使用默认密钥文件生成一个可信访问请求头，便于用 curl 调试接口
+func printAuthHeader(audience string, ttl time.Duration) error {
+	a := authutil.NewAuthenticator()
+	if err := a.LoadKeyFiles(authutil.DefaultKeyFiles()); err != nil {
+		return err
+	}
+	a.SetValidity(ttl)
+	name, value := a.GenerateAuthHeaderValueFor(audience)
+	fmt.Printf("curl -H '%s: %s' <url>\n", name, value)
+	return nil
+}
+
+// transformFile 使用默认密钥文件流式加密或解密文件，未指定输出路径时加密添加 .enc 后缀，解密去掉 .enc 后缀
+func transformFile(src string, dst string, encrypt bool) error {
+	a := authutil.NewAuthenticator()
+	if err := a.LoadKeyFiles(authutil.DefaultKeyFiles()); err != nil {
+		return err
+	}
+
+	if len(dst) == 0 {
+		switch {
+		case encrypt:
+			dst = src + ".enc"
+		case strings.HasSuffix(src, ".enc"):
+			dst = strings.TrimSuffix(src, ".enc")
+		default:
+			dst = src + ".dec"
+		}
+	}
+
+	var err error
+	if encrypt {
+		err = a.EncryptFile(src, dst)
+	} else {
+		err = a.DecryptFile(src, dst)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Written:", dst)
+	return nil
+}
@@ -0,0 +1,115 @@
+package flagutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/secretutil"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const secretUsage = "usage: linc -secret list | get <name> [version] | put <name> [value] | delete <name> | versions <name> | rollback <name> <version> | rewrap"
+
+// runSecretCommand 使用默认密钥文件操作数据目录中的机密存储，put 未给出值时从标准输入读取，避免值留在命令历史中
+func runSecretCommand(command string, args []string) error {
+	a := authutil.NewAuthenticator()
+	if err := a.LoadKeyFiles(authutil.DefaultKeyFiles()); err != nil {
+		return err
+	}
+	store, err := secretutil.NewStore(secretutil.DefaultDir(), a)
+	if err != nil {
+		return err
+	}
+
+	if command == "list" {
+		list, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, info := range list {
+			if len(info.Error) > 0 {
+				fmt.Printf("%s\tunreadable: %s\n", info.Name, info.Error)
+				continue
+			}
+			fmt.Printf("%s\tv%d\t%d versions\n", info.Name, info.Version, len(info.Versions))
+		}
+		return nil
+	}
+	if command == "rewrap" {
+		count, err := store.Rewrap()
+		fmt.Printf("Rewrapped %d versions\n", count)
+		return err
+	}
+
+	if len(args) == 0 {
+		return errors.New(secretUsage)
+	}
+	name := args[0]
+
+	switch command {
+	case "get":
+		version := 0
+		if len(args) > 1 {
+			if version, err = strconv.Atoi(args[1]); err != nil {
+				return fmt.Errorf("invalid version %q", args[1])
+			}
+		}
+		value, _, err := store.GetVersion(name, version)
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+	case "put":
+		var value string
+		if len(args) > 1 {
+			value = args[1]
+		} else {
+			data, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return err
+			}
+			value = strings.TrimRight(string(data), "\r\n")
+		}
+		info, err := store.Put(name, value)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Stored %s version %d\n", info.Name, info.Version)
+	case "delete":
+		if err := store.Delete(name); err != nil {
+			return err
+		}
+		fmt.Println("Deleted", name)
+	case "versions":
+		versions, err := store.Versions(name)
+		if err != nil {
+			return err
+		}
+		for _, v := range versions {
+			current := ""
+			if v.Current {
+				current = "\tcurrent"
+			}
+			fmt.Printf("v%d\t%d%s\n", v.Version, v.CreatedAt, current)
+		}
+	case "rollback":
+		if len(args) < 2 {
+			return errors.New(secretUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		info, err := store.Rollback(name, version)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled %s back to version %d as version %d\n", info.Name, version, info.Version)
+	default:
+		return errors.New(secretUsage)
+	}
+	return nil
+}
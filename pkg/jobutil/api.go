@@ -0,0 +1,182 @@
+package jobutil
+
+import (
+	"errors"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/datautil"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	defaultManager *Manager
+	defaultErr     error
+	defaultOnce    sync.Once
+	jobTTL         = defaultTTL
+)
+
+// SetTTL 设置默认任务管理器中已结束任务的保留时长，需在首次使用前调用
+func SetTTL(ttl time.Duration) {
+	jobTTL = ttl
+}
+
+// Default 获取默认任务管理器，任务状态保存在数据目录的 jobs 文件夹中；首次创建失败时之后每次都返回同一个错误
+func Default() (*Manager, error) {
+	defaultOnce.Do(func() {
+		dir := filepath.Join(datautil.GetRelDataPath(), "jobs")
+		defaultManager, defaultErr = NewManager(dir, jobTTL)
+	})
+	return defaultManager, defaultErr
+}
+
+// Submit 向默认任务管理器提交任务
+func Submit(name string, fn Func) (Job, error) {
+	m, err := Default()
+	if err != nil {
+		return Job{}, err
+	}
+	return m.Submit(name, fn)
+}
+
+// SubmitFunc 提交任务并立即以 202 返回任务快照，供耗时接口直接使用
+func SubmitFunc(c *gin.Context, name string, fn Func) {
+	job, err := Submit(name, fn)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apiutil.Response{
+			Code:    5000,
+			Message: err.Error(),
+			Data:    apiutil.EmptyResponse{},
+		})
+		return
+	}
+	c.JSON(http.StatusAccepted, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    job,
+	})
+}
+
+// RegisterRoutes 在路由组上注册任务查询、取消和订阅接口，全部接口都需要通过 InternalServiceAuth 认证
+func RegisterRoutes(group *gin.RouterGroup) {
+	g := group.Group("", authutil.InternalServiceAuth())
+	g.GET("/jobs", ListJobsFunc)
+	g.GET("/jobs/:id", GetJobFunc)
+	g.GET("/jobs/:id/events", StreamJobFunc)
+	g.POST("/jobs/:id/cancel", CancelJobFunc)
+}
+
+func ListJobsFunc(c *gin.Context) {
+	m, err := Default()
+	if err != nil {
+		abortWithJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    m.List(),
+	})
+}
+
+func GetJobFunc(c *gin.Context) {
+	m, err := Default()
+	if err != nil {
+		abortWithJobError(c, err)
+		return
+	}
+	job, err := m.Get(c.Param("id"))
+	if err != nil {
+		abortWithJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    job,
+	})
+}
+
+func CancelJobFunc(c *gin.Context) {
+	m, err := Default()
+	if err != nil {
+		abortWithJobError(c, err)
+		return
+	}
+	job, err := m.Cancel(c.Param("id"))
+	if err != nil {
+		abortWithJobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    job,
+	})
+}
+
+// StreamJobFunc 以 Server-Sent Events 推送任务状态，直到任务结束或客户端断开；最终状态只推送一次
+func StreamJobFunc(c *gin.Context) {
+	m, err := Default()
+	if err != nil {
+		abortWithJobError(c, err)
+		return
+	}
+	job, updates, unsubscribe, err := m.Subscribe(c.Param("id"))
+	if err != nil {
+		abortWithJobError(c, err)
+		return
+	}
+	defer unsubscribe()
+
+	c.SSEvent("job", job)
+	c.Writer.Flush()
+	last := job
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				// 通道关闭表示任务已结束；最终状态可能因订阅者处理不过来被丢弃，只在尚未推送时补发
+				if !last.Status.Finished() {
+					if final, err := m.Get(job.ID); err == nil {
+						c.SSEvent("job", final)
+					}
+				}
+				return false
+			}
+			c.SSEvent("job", update)
+			last = update
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func abortWithJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrJobNotFound):
+		c.AbortWithStatusJSON(http.StatusNotFound, apiutil.Response{
+			Code:    4040,
+			Message: err.Error(),
+			Data:    apiutil.EmptyResponse{},
+		})
+	case errors.Is(err, ErrJobFinished):
+		c.AbortWithStatusJSON(http.StatusConflict, apiutil.Response{
+			Code:    4090,
+			Message: err.Error(),
+			Data:    apiutil.EmptyResponse{},
+		})
+	default:
+		c.AbortWithStatusJSON(http.StatusInternalServerError, apiutil.Response{
+			Code:    5000,
+			Message: err.Error(),
+			Data:    apiutil.EmptyResponse{},
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package jobutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status 任务状态
+type Status string
+
+const (
+	StatusPending   Status = "pending"   // 已提交，等待执行
+	StatusRunning   Status = "running"   // 执行中
+	StatusSucceeded Status = "succeeded" // 执行成功
+	StatusFailed    Status = "failed"    // 执行失败
+	StatusCanceled  Status = "canceled"  // 已取消
+)
+
+// Finished 任务是否已经结束
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+const (
+	defaultTTL           = 24 * time.Hour // 已结束任务默认保留一天
+	cleanupInterval      = time.Minute    // 过期任务的清理间隔
+	progressPersistDelay = time.Second    // 进度落盘的最小间隔
+	interruptedMessage   = "interrupted by restart"
+)
+
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// Job 任务的状态快照，会以 JSON 形式保存在数据目录中
+type Job struct {
+	ID         string          `json:"id"`
+	Name       string          `json:"name"`
+	Status     Status          `json:"status"`
+	Progress   float64         `json:"progress"` // 进度，0~100
+	Message    string          `json:"message"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  int64           `json:"createdAt"`  // 创建时间，UTC时间戳
+	UpdatedAt  int64           `json:"updatedAt"`  // 更新时间，UTC时间戳
+	FinishedAt int64           `json:"finishedAt"` // 结束时间，UTC时间戳，未结束时为 0
+}
+
+// ProgressFunc 任务执行过程中用于汇报进度
+type ProgressFunc func(percent float64, message string)
+
+// Func 任务的执行体，需要关注 ctx 的取消信号
+type Func func(ctx context.Context, progress ProgressFunc) (interface{}, error)
+
+type entry struct {
+	job         Job
+	cancel      context.CancelFunc
+	subscribers map[chan Job]struct{}
+	persistedAt time.Time
+}
+
+// Manager 任务管理器
+type Manager struct {
+	mu   sync.RWMutex
+	dir  string
+	ttl  time.Duration
+	jobs map[string]*entry
+}
+
+// NewManager 创建任务管理器，dir 为任务状态的保存目录，ttl 为已结束任务的保留时长
+func NewManager(dir string, ttl time.Duration) (*Manager, error) {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		dir:  dir,
+		ttl:  ttl,
+		jobs: make(map[string]*entry),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		// 定期清理过期任务
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			m.Cleanup()
+		}
+	}()
+
+	return m, nil
+}
+
+// Submit 提交任务并立即返回任务快照，任务在后台执行
+func (m *Manager) Submit(name string, fn Func) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	now := time.Now().UnixMilli()
+	ctx, cancel := context.WithCancel(context.Background())
+	e := &entry{
+		job: Job{
+			ID:        id,
+			Name:      name,
+			Status:    StatusPending,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		cancel:      cancel,
+		subscribers: make(map[chan Job]struct{}),
+	}
+
+	m.mu.Lock()
+	m.jobs[id] = e
+	err = m.persistLocked(e)
+	job := e.job
+	m.mu.Unlock()
+	if err != nil {
+		cancel()
+		return Job{}, err
+	}
+
+	go m.run(ctx, e, fn)
+	return job, nil
+}
+
+func (m *Manager) run(ctx context.Context, e *entry, fn Func) {
+	defer e.cancel()
+
+	m.update(e, true, func(job *Job) {
+		job.Status = StatusRunning
+	})
+
+	progress := func(percent float64, message string) {
+		m.update(e, false, func(job *Job) {
+			if job.Status.Finished() {
+				return
+			}
+			job.Progress = percent
+			job.Message = message
+		})
+	}
+
+	result, err := runSafely(ctx, fn, progress)
+
+	m.update(e, true, func(job *Job) {
+		job.FinishedAt = time.Now().UnixMilli()
+		switch {
+		case errors.Is(ctx.Err(), context.Canceled):
+			job.Status = StatusCanceled
+			job.Error = context.Canceled.Error()
+		case err != nil:
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		default:
+			data, marshalErr := json.Marshal(result)
+			if marshalErr != nil {
+				job.Status = StatusFailed
+				job.Error = marshalErr.Error()
+				return
+			}
+			job.Status = StatusSucceeded
+			job.Progress = 100
+			job.Result = data
+		}
+	})
+}
+
+func runSafely(ctx context.Context, fn Func, progress ProgressFunc) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx, progress)
+}
+
+// update 修改任务状态并通知订阅者，force 为 false 时按间隔节流落盘
+func (m *Manager) update(e *entry, force bool, mutate func(job *Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mutate(&e.job)
+	e.job.UpdatedAt = time.Now().UnixMilli()
+
+	if force || time.Since(e.persistedAt) >= progressPersistDelay {
+		_ = m.persistLocked(e)
+	}
+
+	for ch := range e.subscribers {
+		select {
+		case ch <- e.job:
+		default:
+			// 订阅者处理不过来时丢弃中间状态，最终状态由关闭前的快照保证
+		}
+	}
+	if e.job.Status.Finished() {
+		for ch := range e.subscribers {
+			close(ch)
+		}
+		e.subscribers = make(map[chan Job]struct{})
+	}
+}
+
+// Get 获取任务快照
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return e.job, nil
+}
+
+// List 获取全部任务快照，按创建时间升序
+func (m *Manager) List() []Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	jobs := make([]Job, 0, len(m.jobs))
+	for _, e := range m.jobs {
+		jobs = append(jobs, e.job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].CreatedAt < jobs[j].CreatedAt
+	})
+	return jobs
+}
+
+// Cancel 取消任务，任务函数需要响应 ctx 的取消信号
+func (m *Manager) Cancel(id string) (Job, error) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	if e.job.Status.Finished() {
+		job := e.job
+		m.mu.Unlock()
+		return job, ErrJobFinished
+	}
+	cancel := e.cancel
+	m.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+	return m.Get(id)
+}
+
+// Subscribe 订阅任务状态变化，任务结束时通道会被关闭；返回的函数用于取消订阅
+func (m *Manager) Subscribe(id string) (Job, <-chan Job, func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.jobs[id]
+	if !ok {
+		return Job{}, nil, nil, ErrJobNotFound
+	}
+
+	ch := make(chan Job, 16)
+	if e.job.Status.Finished() {
+		close(ch)
+		return e.job, ch, func() {}, nil
+	}
+	e.subscribers[ch] = struct{}{}
+
+	unsubscribe := func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := e.subscribers[ch]; ok {
+			delete(e.subscribers, ch)
+			close(ch)
+		}
+	}
+	return e.job, ch, unsubscribe, nil
+}
+
+// Cleanup 删除超过保留时长的已结束任务
+func (m *Manager) Cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deadline := time.Now().Add(-m.ttl).UnixMilli()
+	for id, e := range m.jobs {
+		if e.job.Status.Finished() && e.job.FinishedAt < deadline {
+			delete(m.jobs, id)
+			_ = os.Remove(m.jobFile(id))
+		}
+	}
+}
+
+/*****************************************************************
+*							持久化
+*****************************************************************/
+
+func (m *Manager) jobFile(id string) string {
+	return filepath.Join(m.dir, id+".json")
+}
+
+func (m *Manager) persistLocked(e *entry) error {
+	data, err := json.Marshal(e.job)
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免进程中断时留下半个文件
+	tmpFile := m.jobFile(e.job.ID) + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile, m.jobFile(e.job.ID)); err != nil {
+		return err
+	}
+	e.persistedAt = time.Now()
+	return nil
+}
+
+// load 从数据目录恢复任务，重启前未结束的任务标记为失败
+func (m *Manager) load() error {
+	files, err := os.ReadDir(m.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(m.dir, file.Name()))
+		if err != nil {
+			continue
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil || job.ID == "" {
+			continue
+		}
+
+		e := &entry{job: job, subscribers: make(map[chan Job]struct{})}
+		if !job.Status.Finished() {
+			now := time.Now().UnixMilli()
+			e.job.Status = StatusFailed
+			e.job.Error = interruptedMessage
+			e.job.UpdatedAt = now
+			e.job.FinishedAt = now
+			_ = m.persistLocked(e)
+		}
+		m.jobs[job.ID] = e
+	}
+	return nil
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,217 @@
+package jobutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	m, err := NewManager(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// waitFinished 订阅任务直到结束，返回最终快照
+func waitFinished(t *testing.T, m *Manager, id string) Job {
+	t.Helper()
+	_, updates, unsubscribe, err := m.Subscribe(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unsubscribe()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-updates:
+			if !ok {
+				job, err := m.Get(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return job
+			}
+		case <-timeout:
+			t.Fatalf("job %s did not finish", id)
+		}
+	}
+}
+
+func TestSubmitSucceeds(t *testing.T) {
+	m := newTestManager(t)
+	job, err := m.Submit("export", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		progress(50, "half")
+		return map[string]string{"file": "logs.zip"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	final := waitFinished(t, m, job.ID)
+	if final.Status != StatusSucceeded || final.Progress != 100 || string(final.Result) != `{"file":"logs.zip"}` {
+		t.Errorf("final = %+v", final)
+	}
+
+	// 状态已落盘
+	data, err := os.ReadFile(filepath.Join(m.dir, job.ID+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var persisted Job
+	if err := json.Unmarshal(data, &persisted); err != nil || persisted.Status != StatusSucceeded {
+		t.Errorf("persisted = %+v, err = %v", persisted, err)
+	}
+}
+
+func TestSubmitFailsAndPanics(t *testing.T) {
+	m := newTestManager(t)
+	failed, _ := m.Submit("fail", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		return nil, errors.New("disk full")
+	})
+	panicked, _ := m.Submit("panic", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		panic("boom")
+	})
+
+	if job := waitFinished(t, m, failed.ID); job.Status != StatusFailed || job.Error != "disk full" {
+		t.Errorf("failed job = %+v", job)
+	}
+	if job := waitFinished(t, m, panicked.ID); job.Status != StatusFailed || !strings.Contains(job.Error, "boom") {
+		t.Errorf("panicked job = %+v", job)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	m := newTestManager(t)
+	job, _ := m.Submit("wait", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	if _, err := m.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if final := waitFinished(t, m, job.ID); final.Status != StatusCanceled {
+		t.Errorf("status = %s, want %s", final.Status, StatusCanceled)
+	}
+	if _, err := m.Cancel(job.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("second cancel err = %v, want %v", err, ErrJobFinished)
+	}
+	if _, err := m.Cancel("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("missing cancel err = %v, want %v", err, ErrJobNotFound)
+	}
+}
+
+func TestRestartMarksUnfinishedJobsFailed(t *testing.T) {
+	dir := t.TempDir()
+	data, _ := json.Marshal(Job{ID: "abc", Name: "migrate", Status: StatusRunning})
+	if err := os.WriteFile(filepath.Join(dir, "abc.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := m.Get("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != StatusFailed || job.Error != interruptedMessage || job.FinishedAt == 0 {
+		t.Errorf("job = %+v", job)
+	}
+}
+
+func TestCleanupRemovesExpiredJobs(t *testing.T) {
+	m := newTestManager(t)
+	job, _ := m.Submit("quick", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		return nil, nil
+	})
+	waitFinished(t, m, job.ID)
+
+	m.ttl = -time.Minute
+	m.Cleanup()
+	if _, err := m.Get(job.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("err = %v, want %v", err, ErrJobNotFound)
+	}
+	if _, err := os.Stat(filepath.Join(m.dir, job.ID+".json")); !os.IsNotExist(err) {
+		t.Errorf("job file still exists: %v", err)
+	}
+}
+
+// closeNotifyingRecorder gin 的 Stream 需要 CloseNotify
+type closeNotifyingRecorder struct {
+	*httptest.ResponseRecorder
+	closed chan bool
+}
+
+func (r closeNotifyingRecorder) CloseNotify() <-chan bool {
+	return r.closed
+}
+
+func streamEvents(t *testing.T, id string) []Job {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/jobs/:id/events", StreamJobFunc)
+
+	w := closeNotifyingRecorder{httptest.NewRecorder(), make(chan bool, 1)}
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/"+id+"/events", nil))
+
+	var events []Job
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			var job Job
+			if err := json.Unmarshal([]byte(data), &job); err != nil {
+				t.Fatalf("parse event %q: %v", data, err)
+			}
+			events = append(events, job)
+		}
+	}
+	return events
+}
+
+func TestStreamJobFuncSendsFinalStateOnce(t *testing.T) {
+	m := newTestManager(t)
+	defaultOnce.Do(func() { defaultManager = m })
+	if current, _ := Default(); current != m {
+		t.Skip("default manager was already created")
+	}
+
+	// 已结束的任务只推送一次最终状态
+	done, _ := m.Submit("done", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		return nil, nil
+	})
+	waitFinished(t, m, done.ID)
+	if events := streamEvents(t, done.ID); len(events) != 1 || events[0].Status != StatusSucceeded {
+		t.Errorf("events for finished job = %+v", events)
+	}
+
+	// 订阅后才结束的任务，最终状态同样只出现一次
+	release := make(chan struct{})
+	running, _ := m.Submit("running", func(ctx context.Context, progress ProgressFunc) (interface{}, error) {
+		<-release
+		return nil, nil
+	})
+	time.AfterFunc(50*time.Millisecond, func() { close(release) })
+	finished := 0
+	for _, job := range streamEvents(t, running.ID) {
+		if job.Status.Finished() {
+			finished++
+		}
+	}
+	if finished != 1 {
+		t.Errorf("terminal events = %d, want 1", finished)
+	}
+}
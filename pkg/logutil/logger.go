@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -16,9 +17,11 @@ import (
 )
 
 var (
-	logger      *zap.Logger
-	once        sync.Once
-	lastLogTime time.Time
+	logger       atomic.Pointer[zap.Logger] // InitLogger 写入，日志函数并发读取
+	once         sync.Once
+	lastLogTime  time.Time
+	fallback     *zap.Logger
+	fallbackOnce sync.Once
 )
 
 func InitLogger() {
@@ -53,7 +56,7 @@ func InitLogger() {
 			zapcore.NewCore(consoleEncoder, zapcore.AddSync(os.Stdout), zapcore.InfoLevel),
 		)
 
-		logger = zap.New(core)
+		logger.Store(zap.New(core))
 
 		go func() {
 			// 定期检查并sync
@@ -78,41 +81,54 @@ func InitLogger() {
 	})
 }
 
+// current 返回当前日志器，未调用 InitLogger 时仅输出到控制台
+func current() *zap.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	fallbackOnce.Do(func() {
+		config := zap.NewProductionEncoderConfig()
+		config.EncodeTime = zapcore.ISO8601TimeEncoder
+		fallback = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(config), zapcore.AddSync(os.Stdout), zapcore.InfoLevel))
+	})
+	return fallback
+}
+
 func Printf(format string, args ...interface{}) {
-	logger.Info(fmt.Sprintf(format, args...))
+	current().Info(fmt.Sprintf(format, args...))
 	lastLogTime = time.Now()
 }
 
 func Errorf(format string, args ...interface{}) {
-	logger.Info(fmt.Sprintf(format, args...))
+	current().Info(fmt.Sprintf(format, args...))
 	lastLogTime = time.Now()
 }
 
 func Print(args ...interface{}) {
-	logger.Info(fmt.Sprint(args...))
+	current().Info(fmt.Sprint(args...))
 	lastLogTime = time.Now()
 }
 
 func Println(args ...interface{}) {
-	logger.Info(fmt.Sprintln(args...))
+	current().Info(fmt.Sprintln(args...))
 	lastLogTime = time.Now()
 }
 
 func Fatal(args ...interface{}) {
-	logger.Fatal(fmt.Sprint(args...))
+	current().Fatal(fmt.Sprint(args...))
 	lastLogTime = time.Now()
 }
 
 func Fatalf(format string, args ...interface{}) {
-	logger.Fatal(fmt.Sprintf(format, args...))
+	current().Fatal(fmt.Sprintf(format, args...))
 	lastLogTime = time.Now()
 }
 
 func Fatalln(args ...interface{}) {
-	logger.Fatal(fmt.Sprintln(args...))
+	current().Fatal(fmt.Sprintln(args...))
 	lastLogTime = time.Now()
 }
 
 func Sync() {
-	_ = logger.Sync()
+	_ = current().Sync()
 }
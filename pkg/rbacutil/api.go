@@ -0,0 +1,87 @@
+package rbacutil
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/datautil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	defaultEnforcer *Enforcer
+	defaultOnce     sync.Once
+)
+
+// DefaultPolicyFile 默认策略文件，位于数据目录下
+func DefaultPolicyFile() string {
+	return filepath.Join(datautil.GetRelDataPath(), "rbac.yaml")
+}
+
+// Default 获取默认权限评估器，首次使用时加载数据目录下的 rbac.yaml 并监视其变化；文件不存在时拒绝全部请求
+func Default() *Enforcer {
+	defaultOnce.Do(func() {
+		defaultEnforcer = NewEnforcer()
+		_ = defaultEnforcer.WatchFile(DefaultPolicyFile(), defaultWatchInterval)
+	})
+	return defaultEnforcer
+}
+
+// Require 使用默认权限评估器检查路由权限，需放在 InternalServiceAuth 之后
+func Require(permission string) gin.HandlerFunc {
+	return Default().Require(permission)
+}
+
+type evaluateRequest struct {
+	Permission string   `json:"permission" binding:"required"`
+	Subject    *Subject `json:"subject"` // 待评估的主体，为空时评估调用方自身
+}
+
+// RegisterRoutes 在路由组上注册策略查询和评估接口，需要通过 InternalServiceAuth 认证且具备管理员身份
+func RegisterRoutes(group *gin.RouterGroup) {
+	g := group.Group("", authutil.InternalServiceAuth(), authutil.RequireAdmin())
+	g.GET("/rbac/policy", PolicyFunc)
+	g.POST("/rbac/evaluate", EvaluateFunc)
+}
+
+// PolicyFunc 返回当前生效的策略和加载状态
+func PolicyFunc(c *gin.Context) {
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data: gin.H{
+			"status": Default().Status(),
+			"policy": Default().Policy(),
+		},
+	})
+}
+
+// EvaluateFunc 评估主体是否拥有权限，返回获得的角色和允许或拒绝的原因，用于排查请求被拒绝的原因
+func EvaluateFunc(c *gin.Context) {
+	var req evaluateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, apiutil.Response{
+			Code:    4000,
+			Message: err.Error(),
+			Data:    apiutil.EmptyResponse{},
+		})
+		return
+	}
+
+	var subject Subject
+	switch {
+	case req.Subject != nil:
+		subject = *req.Subject
+	default:
+		identity, _ := authutil.GetIdentity(c)
+		subject = SubjectOf(identity)
+	}
+
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    Default().EvaluateSubject(subject, req.Permission),
+	})
+}
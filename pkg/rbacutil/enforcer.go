@@ -0,0 +1,218 @@
+package rbacutil
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/logutil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultWatchInterval = 5 * time.Second // 检查策略文件变化的间隔
+
+// PolicyStatus 策略文件的加载状态
+type PolicyStatus struct {
+	Path      string `json:"path,omitempty"`
+	Loaded    bool   `json:"loaded"`              // 是否成功加载过策略
+	LoadedAt  int64  `json:"loadedAt,omitempty"`  // 最近一次成功加载的时间，UTC时间戳
+	LastError string `json:"lastError,omitempty"` // 最近一次加载失败的原因，成功后清空
+	Watching  bool   `json:"watching"`
+	Roles     int    `json:"roles"`
+	Bindings  int    `json:"bindings"`
+}
+
+// Enforcer 权限评估器，持有当前生效的策略；策略文件重新加载失败时保留原有策略
+type Enforcer struct {
+	mu     sync.RWMutex
+	policy *compiledPolicy
+	path   string
+	stamp  os.FileInfo
+	status PolicyStatus
+	stop   chan struct{}
+}
+
+// NewEnforcer 创建权限评估器，未设置策略前拒绝全部请求
+func NewEnforcer() *Enforcer {
+	policy, _ := compile(Policy{})
+	return &Enforcer{policy: policy}
+}
+
+// SetPolicy 直接设置策略，适用于策略由代码生成的场景
+func (e *Enforcer) SetPolicy(policy Policy) error {
+	compiled, err := compile(policy)
+	if err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.policy = compiled
+	e.status.Loaded = true
+	e.status.LoadedAt = time.Now().UnixMilli()
+	e.status.LastError = ""
+	e.status.Roles = len(policy.Roles)
+	e.status.Bindings = len(policy.Bindings)
+	return nil
+}
+
+// LoadFile 从 YAML 文件加载策略，失败时保留原有策略
+func (e *Enforcer) LoadFile(path string) error {
+	e.mu.Lock()
+	e.path = path
+	e.status.Path = path
+	e.mu.Unlock()
+	return e.reload()
+}
+
+func (e *Enforcer) reload() error {
+	e.mu.RLock()
+	path := e.path
+	e.mu.RUnlock()
+
+	info, statErr := os.Stat(path)
+	err := statErr
+	var policy Policy
+	if err == nil {
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			policy, err = ParsePolicy(data)
+		}
+	}
+	if err == nil {
+		err = e.SetPolicy(policy)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if statErr == nil {
+		e.stamp = info
+	}
+	if err != nil {
+		e.status.LastError = err.Error()
+		logutil.Println("访问控制策略加载失败，保留原有策略：", err)
+		return err
+	}
+	logutil.Println("访问控制策略加载成功：", path)
+	return nil
+}
+
+// changed 策略文件的修改时间、大小或权限发生变化
+func (e *Enforcer) changed() bool {
+	e.mu.RLock()
+	path, stamp := e.path, e.stamp
+	e.mu.RUnlock()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return stamp == nil || !stamp.ModTime().Equal(info.ModTime()) || stamp.Size() != info.Size() || stamp.Mode() != info.Mode()
+}
+
+// WatchFile 加载策略文件，并在文件变化时自动重新加载
+func (e *Enforcer) WatchFile(path string, interval time.Duration) error {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	err := e.LoadFile(path)
+
+	e.mu.Lock()
+	if e.stop != nil {
+		close(e.stop)
+	}
+	stop := make(chan struct{})
+	e.stop = stop
+	e.status.Watching = true
+	e.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if e.changed() {
+					logutil.Println("访问控制策略文件发生变化，重新加载")
+					_ = e.reload()
+				}
+			}
+		}
+	}()
+	return err
+}
+
+// StopWatching 停止监视策略文件，当前策略保持不变
+func (e *Enforcer) StopWatching() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stop != nil {
+		close(e.stop)
+		e.stop = nil
+	}
+	e.status.Watching = false
+}
+
+// Status 获取策略的加载状态
+func (e *Enforcer) Status() PolicyStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.status
+}
+
+// Policy 获取当前生效的策略
+func (e *Enforcer) Policy() Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.policy.policy
+}
+
+// Evaluate 评估调用方是否拥有指定权限
+func (e *Enforcer) Evaluate(identity authutil.Identity, permission string) Decision {
+	return e.EvaluateSubject(SubjectOf(identity), permission)
+}
+
+// EvaluateSubject 评估主体是否拥有指定权限
+func (e *Enforcer) EvaluateSubject(subject Subject, permission string) Decision {
+	e.mu.RLock()
+	policy := e.policy
+	e.mu.RUnlock()
+	return policy.evaluate(subject, permission)
+}
+
+// Require 路由的权限检查中间件，需放在认证中间件之后；未拥有权限时返回 403
+func (e *Enforcer) Require(permission string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		identity, ok := authutil.GetIdentity(ctx)
+		if !ok {
+			logutil.Println("[RBAC] 未找到调用方身份，请将权限检查放在认证中间件之后：", ctx.Request.URL.Path)
+			abortForbidden(ctx, permission)
+			return
+		}
+
+		decision := e.Evaluate(identity, permission)
+		if !decision.Allowed {
+			logutil.Println("[RBAC] 拒绝访问：", ctx.Request.Method, ctx.Request.URL.Path, decision.Reason)
+			abortForbidden(ctx, permission)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// PermissionDenied 权限不足时返回体中的数据
+type PermissionDenied struct {
+	Permission string `json:"permission"`
+}
+
+func abortForbidden(ctx *gin.Context, permission string) {
+	ctx.AbortWithStatusJSON(http.StatusForbidden, apiutil.Response{
+		Code:    4031,
+		Message: "permission denied",
+		Data:    PermissionDenied{Permission: permission},
+	})
+}
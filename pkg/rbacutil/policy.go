@@ -0,0 +1,229 @@
+package rbacutil
+
+import (
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+)
+
+// Policy 访问控制策略，角色映射到权限，绑定把角色授予用户、服务或网关管理员
+type Policy struct {
+	Roles    map[string]Role `yaml:"roles" json:"roles"`
+	Bindings []Binding       `yaml:"bindings" json:"bindings"`
+}
+
+// Role 角色，权限支持 * 表示全部，orders:* 表示 orders: 开头的全部权限
+type Role struct {
+	Permissions []string `yaml:"permissions" json:"permissions"`
+	Inherits    []string `yaml:"inherits,omitempty" json:"inherits,omitempty"` // 继承其他角色的全部权限
+}
+
+// Binding 角色绑定，每种认证方式使用各自的名称空间：users 和 admins 只匹配网关传递的用户 ID 和管理员，
+// jwtUsers 和 jwtAdmins 只匹配 JWT 的 sub 和 admin 声明，apiKeys 匹配外部客户端 API Key 的名称，
+// services 匹配请求头、请求签名、双向 TLS 和会话认证的服务名称；bypassed 匹配命中放行规则或调试模式的请求。
+// 注意请求头认证的服务名称由调用方自行声明，只要持有公钥即可声明任意名称，services 绑定不能区分这些调用方
+type Binding struct {
+	Role      string   `yaml:"role" json:"role"`
+	Users     []string `yaml:"users,omitempty" json:"users,omitempty"`
+	JWTUsers  []string `yaml:"jwtUsers,omitempty" json:"jwtUsers,omitempty"`
+	Services  []string `yaml:"services,omitempty" json:"services,omitempty"`
+	APIKeys   []string `yaml:"apiKeys,omitempty" json:"apiKeys,omitempty"`
+	Admins    bool     `yaml:"admins,omitempty" json:"admins,omitempty"`
+	JWTAdmins bool     `yaml:"jwtAdmins,omitempty" json:"jwtAdmins,omitempty"`
+	Bypassed  bool     `yaml:"bypassed,omitempty" json:"bypassed,omitempty"`
+}
+
+// ParsePolicy 解析 YAML 格式的策略并检查角色引用
+func ParsePolicy(data []byte) (Policy, error) {
+	var policy Policy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return Policy{}, fmt.Errorf("parse policy: %w", err)
+	}
+	if _, err := compile(policy); err != nil {
+		return Policy{}, err
+	}
+	return policy, nil
+}
+
+// compiledPolicy 展开继承关系后的策略
+type compiledPolicy struct {
+	policy      Policy
+	permissions map[string][]string // 角色展开继承后的全部权限
+}
+
+func compile(policy Policy) (*compiledPolicy, error) {
+	c := &compiledPolicy{policy: policy, permissions: make(map[string][]string)}
+	for name := range policy.Roles {
+		if _, err := c.expand(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	for i, binding := range policy.Bindings {
+		if _, ok := policy.Roles[binding.Role]; !ok {
+			return nil, fmt.Errorf("binding %d refers to unknown role %q", i, binding.Role)
+		}
+	}
+	return c, nil
+}
+
+// expand 展开角色的继承关系，path 用于发现循环继承
+func (c *compiledPolicy) expand(name string, path []string) ([]string, error) {
+	if permissions, ok := c.permissions[name]; ok {
+		return permissions, nil
+	}
+	for _, p := range path {
+		if p == name {
+			return nil, fmt.Errorf("role %q inherits itself: %s", name, strings.Join(append(path, name), " -> "))
+		}
+	}
+	role, ok := c.policy.Roles[name]
+	if !ok {
+		return nil, fmt.Errorf("role %q is not defined", name)
+	}
+
+	permissions := append([]string(nil), role.Permissions...)
+	for _, parent := range role.Inherits {
+		inherited, err := c.expand(parent, append(path, name))
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, inherited...)
+	}
+	c.permissions[name] = permissions
+	return permissions, nil
+}
+
+/*****************************************************************
+*							评估
+*****************************************************************/
+
+// Subject 参与评估的调用方，取自认证中间件写入的身份
+type Subject struct {
+	Method  string `json:"method"`
+	UserId  string `json:"userId,omitempty"`
+	Service string `json:"service,omitempty"`
+	IsAdmin bool   `json:"isAdmin,omitempty"`
+}
+
+// SubjectOf 把认证身份转换为评估主体
+func SubjectOf(identity authutil.Identity) Subject {
+	return Subject{
+		Method:  identity.Method,
+		UserId:  identity.UserId,
+		Service: identity.Service,
+		IsAdmin: identity.IsAdmin,
+	}
+}
+
+// Grant 授予主体的一个角色及授予原因
+type Grant struct {
+	Role        string   `json:"role"`
+	Via         string   `json:"via"` // 匹配的绑定，例如 user:42、jwtuser:42、service:order、apikey:partner、admins 或 bypassed
+	Permissions []string `json:"permissions"`
+}
+
+// Decision 权限评估结果，记录主体获得的全部角色，便于排查拒绝原因
+type Decision struct {
+	Allowed    bool    `json:"allowed"`
+	Permission string  `json:"permission"`
+	Subject    Subject `json:"subject"`
+	Grants     []Grant `json:"grants"`
+	MatchedBy  string  `json:"matchedBy,omitempty"` // 允许时为匹配的角色和权限，例如 operator:orders:*
+	Reason     string  `json:"reason"`
+}
+
+// evaluate 按绑定收集主体的角色，任一角色的权限匹配即允许；
+// 命中放行规则或调试模式的请求没有可信的主体，只有显式的 bypassed 绑定才会授予角色
+func (c *compiledPolicy) evaluate(subject Subject, permission string) Decision {
+	decision := Decision{Permission: permission, Subject: subject, Grants: []Grant{}}
+
+	for _, binding := range c.policy.Bindings {
+		via, ok := binding.match(subject)
+		if !ok {
+			continue
+		}
+		grant := Grant{Role: binding.Role, Via: via, Permissions: c.permissions[binding.Role]}
+		decision.Grants = append(decision.Grants, grant)
+		if decision.Allowed {
+			continue
+		}
+		for _, p := range grant.Permissions {
+			if matchPermission(p, permission) {
+				decision.Allowed = true
+				decision.MatchedBy = binding.Role + ":" + p
+				decision.Reason = fmt.Sprintf("role %q granted via %s allows %q", binding.Role, via, permission)
+				break
+			}
+		}
+	}
+
+	if !decision.Allowed {
+		if len(decision.Grants) == 0 {
+			decision.Reason = "no role is bound to this subject"
+		} else {
+			roles := make([]string, 0, len(decision.Grants))
+			for _, grant := range decision.Grants {
+				roles = append(roles, grant.Role)
+			}
+			sort.Strings(roles)
+			decision.Reason = fmt.Sprintf("none of the roles %s allows %q", strings.Join(roles, ", "), permission)
+		}
+	}
+	return decision
+}
+
+// match 按主体的认证方式选择绑定中对应的名称空间
+func (b Binding) match(subject Subject) (string, bool) {
+	switch subject.Method {
+	case authutil.MethodGateway:
+		if via, ok := matchName(b.Users, subject.UserId, "user:"); ok {
+			return via, true
+		}
+		if b.Admins && subject.IsAdmin {
+			return "admins", true
+		}
+	case authutil.MethodJWT:
+		if via, ok := matchName(b.JWTUsers, subject.UserId, "jwtuser:"); ok {
+			return via, true
+		}
+		if b.JWTAdmins && subject.IsAdmin {
+			return "jwtAdmins", true
+		}
+	case authutil.MethodAPIKey:
+		// API Key 的名称由管理员任意填写，不能与内部服务名称混用
+		return matchName(b.APIKeys, subject.Service, "apikey:")
+	case authutil.MethodHeader, authutil.MethodSignature, authutil.MethodMTLS, authutil.MethodSession:
+		return matchName(b.Services, subject.Service, "service:")
+	case authutil.MethodBypass, authutil.MethodDebug:
+		if b.Bypassed {
+			return "bypassed", true
+		}
+	}
+	return "", false
+}
+
+func matchName(names []string, value string, prefix string) (string, bool) {
+	if len(value) == 0 {
+		return "", false
+	}
+	for _, name := range names {
+		if name == value {
+			return prefix + name, true
+		}
+	}
+	return "", false
+}
+
+// matchPermission 权限匹配：* 匹配全部，以 * 结尾时按前缀匹配，其余精确匹配
+func matchPermission(granted string, required string) bool {
+	switch {
+	case granted == "*":
+		return true
+	case strings.HasSuffix(granted, "*"):
+		return strings.HasPrefix(required, strings.TrimSuffix(granted, "*"))
+	default:
+		return granted == required
+	}
+}
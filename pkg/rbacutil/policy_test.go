@@ -0,0 +1,113 @@
+package rbacutil
+
+import (
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"testing"
+)
+
+const testPolicy = `
+roles:
+  viewer:
+    permissions: ["orders:read"]
+  operator:
+    inherits: [viewer]
+    permissions: ["orders:*"]
+  root:
+    permissions: ["*"]
+  local:
+    permissions: ["health:read"]
+bindings:
+  - role: operator
+    users: ["42"]
+  - role: viewer
+    jwtUsers: ["7"]
+  - role: viewer
+    services: [inventory]
+    apiKeys: [partner]
+  - role: root
+    admins: true
+  - role: operator
+    jwtAdmins: true
+  - role: local
+    bypassed: true
+`
+
+func compileTestPolicy(t *testing.T) *compiledPolicy {
+	t.Helper()
+	policy, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compiled, err := compile(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return compiled
+}
+
+func TestEvaluate(t *testing.T) {
+	c := compileTestPolicy(t)
+
+	tests := []struct {
+		name       string
+		subject    Subject
+		permission string
+		allowed    bool
+	}{
+		{"gateway user", Subject{Method: authutil.MethodGateway, UserId: "42"}, "orders:write", true},
+		{"gateway user inherits", Subject{Method: authutil.MethodGateway, UserId: "42"}, "orders:read", true},
+		{"gateway user outside role", Subject{Method: authutil.MethodGateway, UserId: "42"}, "users:delete", false},
+		{"jwt sub is not a gateway user", Subject{Method: authutil.MethodJWT, UserId: "42"}, "orders:write", false},
+		{"jwt user", Subject{Method: authutil.MethodJWT, UserId: "7"}, "orders:read", true},
+		{"gateway user is not a jwt user", Subject{Method: authutil.MethodGateway, UserId: "7"}, "orders:read", false},
+		{"gateway admin", Subject{Method: authutil.MethodGateway, IsAdmin: true}, "users:delete", true},
+		{"jwt admin is not a gateway admin", Subject{Method: authutil.MethodJWT, IsAdmin: true}, "users:delete", false},
+		{"jwt admin", Subject{Method: authutil.MethodJWT, IsAdmin: true}, "orders:write", true},
+		{"header service", Subject{Method: authutil.MethodHeader, Service: "inventory"}, "orders:read", true},
+		{"signature service", Subject{Method: authutil.MethodSignature, Service: "inventory"}, "orders:read", true},
+		{"mtls service", Subject{Method: authutil.MethodMTLS, Service: "inventory"}, "orders:write", false},
+		{"jwt svc is not a service", Subject{Method: authutil.MethodJWT, Service: "inventory"}, "orders:read", false},
+		{"api key named like a service", Subject{Method: authutil.MethodAPIKey, Service: "inventory"}, "orders:read", false},
+		{"api key", Subject{Method: authutil.MethodAPIKey, Service: "partner"}, "orders:read", true},
+		{"service named like an api key", Subject{Method: authutil.MethodHeader, Service: "partner"}, "orders:read", false},
+		{"signed url", Subject{Method: authutil.MethodSignedURL, Service: "inventory"}, "orders:read", false},
+		{"bypass outside bypassed binding", Subject{Method: authutil.MethodBypass}, "orders:read", false},
+		{"bypass with admin flag", Subject{Method: authutil.MethodBypass, IsAdmin: true}, "users:delete", false},
+		{"debug", Subject{Method: authutil.MethodDebug}, "orders:read", false},
+		{"bypassed binding", Subject{Method: authutil.MethodBypass}, "health:read", true},
+		{"empty subject", Subject{}, "health:read", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := c.evaluate(tt.subject, tt.permission)
+			if decision.Allowed != tt.allowed {
+				t.Errorf("allowed = %v, want %v (%s)", decision.Allowed, tt.allowed, decision.Reason)
+			}
+		})
+	}
+}
+
+func TestEvaluateDenyWithoutPolicy(t *testing.T) {
+	c, err := compile(Policy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{authutil.MethodBypass, authutil.MethodDebug, authutil.MethodHeader} {
+		if decision := c.evaluate(Subject{Method: method, Service: "inventory"}, "orders:read"); decision.Allowed {
+			t.Errorf("%s allowed by an empty policy", method)
+		}
+	}
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	tests := map[string]string{
+		"unknown role":     "roles: {}\nbindings:\n  - role: ghost\n    users: [\"1\"]\n",
+		"inheritance loop": "roles:\n  a: {inherits: [b]}\n  b: {inherits: [a]}\n",
+		"undefined parent": "roles:\n  a: {inherits: [missing]}\n",
+	}
+	for name, data := range tests {
+		if _, err := ParsePolicy([]byte(data)); err == nil {
+			t.Errorf("%s: ParsePolicy succeeded", name)
+		}
+	}
+}
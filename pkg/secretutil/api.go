@@ -0,0 +1,201 @@
+package secretutil
+
+import (
+	"errors"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/datautil"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+var (
+	defaultStore *Store
+	defaultOnce  sync.Once
+)
+
+// DefaultDir 默认机密存储所在的目录，即数据目录下的 secrets 文件夹
+func DefaultDir() string {
+	return filepath.Join(datautil.GetRelDataPath(), "secrets")
+}
+
+// Default 获取默认机密存储，使用 authutil 的默认认证器加解密
+func Default() *Store {
+	defaultOnce.Do(func() {
+		s, err := NewStore(DefaultDir(), authutil.Default())
+		if err != nil {
+			panic(err)
+		}
+		defaultStore = s
+	})
+	return defaultStore
+}
+
+// Get 读取默认机密存储中机密的当前值
+func Get(name string) (string, error) {
+	value, _, err := Default().Get(name)
+	return value, err
+}
+
+// Put 向默认机密存储写入机密的新版本
+func Put(name string, value string) (SecretInfo, error) {
+	return Default().Put(name, value)
+}
+
+type putSecretRequest struct {
+	Value string `json:"value"`
+}
+
+type rollbackRequest struct {
+	Version int `json:"version" binding:"required"`
+}
+
+// SecretValue 机密的值和元数据
+type SecretValue struct {
+	SecretInfo
+	Value string `json:"value"`
+}
+
+// RegisterRoutes 在路由组上注册机密管理接口，全部接口都需要通过 InternalServiceAuth 认证，
+// 经网关访问的用户还必须是管理员，外部客户端的 API Key 不能访问
+func RegisterRoutes(group *gin.RouterGroup) {
+	g := group.Group("", authutil.InternalServiceAuth(), authutil.RequireAdmin())
+	g.GET("/secrets", ListSecretsFunc)
+	g.GET("/secrets/:name", GetSecretFunc)
+	g.PUT("/secrets/:name", PutSecretFunc)
+	g.DELETE("/secrets/:name", DeleteSecretFunc)
+	g.GET("/secrets/:name/versions", ListVersionsFunc)
+	g.POST("/secrets/:name/rollback", RollbackSecretFunc)
+}
+
+// ListSecretsFunc 列出全部机密的元数据
+func ListSecretsFunc(c *gin.Context) {
+	list, err := Default().List()
+	if err != nil {
+		abortWithSecretError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    list,
+	})
+}
+
+// GetSecretFunc 读取机密的值，可通过 version 查询参数指定版本
+func GetSecretFunc(c *gin.Context) {
+	version := 0
+	if v := c.Query("version"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			abortWithSecretError(c, ErrVersionNotFound)
+			return
+		}
+		version = n
+	}
+
+	value, info, err := Default().GetVersion(c.Param("name"), version)
+	if err != nil {
+		abortWithSecretError(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    SecretValue{SecretInfo: info, Value: value},
+	})
+}
+
+// PutSecretFunc 写入机密的新版本，请求体为 {"value": "..."}
+func PutSecretFunc(c *gin.Context) {
+	var req putSecretRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, apiutil.Response{
+			Code:    4000,
+			Message: err.Error(),
+			Data:    apiutil.EmptyResponse{},
+		})
+		return
+	}
+
+	info, err := Default().Put(c.Param("name"), req.Value)
+	if err != nil {
+		abortWithSecretError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    info,
+	})
+}
+
+// DeleteSecretFunc 删除机密及其全部版本
+func DeleteSecretFunc(c *gin.Context) {
+	if err := Default().Delete(c.Param("name")); err != nil {
+		abortWithSecretError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    apiutil.EmptyResponse{},
+	})
+}
+
+// ListVersionsFunc 列出机密保留的全部版本
+func ListVersionsFunc(c *gin.Context) {
+	versions, err := Default().Versions(c.Param("name"))
+	if err != nil {
+		abortWithSecretError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    versions,
+	})
+}
+
+// RollbackSecretFunc 回滚到指定版本，请求体为 {"version": n}
+func RollbackSecretFunc(c *gin.Context) {
+	var req rollbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, apiutil.Response{
+			Code:    4000,
+			Message: err.Error(),
+			Data:    apiutil.EmptyResponse{},
+		})
+		return
+	}
+
+	info, err := Default().Rollback(c.Param("name"), req.Version)
+	if err != nil {
+		abortWithSecretError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    info,
+	})
+}
+
+func abortWithSecretError(c *gin.Context, err error) {
+	status, code := http.StatusInternalServerError, 5000
+	switch {
+	case errors.Is(err, ErrSecretNotFound), errors.Is(err, ErrVersionNotFound):
+		status, code = http.StatusNotFound, 4040
+	case errors.Is(err, ErrInvalidName):
+		status, code = http.StatusBadRequest, 4000
+	}
+	c.AbortWithStatusJSON(status, apiutil.Response{
+		Code:    code,
+		Message: err.Error(),
+		Data:    apiutil.EmptyResponse{},
+	})
+}
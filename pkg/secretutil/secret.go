@@ -0,0 +1,380 @@
+package secretutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMaxVersions = 10 // 每个机密默认保留的版本数
+
+var (
+	ErrSecretNotFound  = errors.New("secret not found")
+	ErrVersionNotFound = errors.New("secret version not found")
+	ErrInvalidName     = errors.New("invalid secret name")
+)
+
+// namePattern 机密名称只允许字母、数字以及 . _ -，同时作为文件名使用
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,127}$`)
+
+// Version 机密的一个版本，值以混合加密信封的形式保存
+type Version struct {
+	Version   int                    `json:"version"`
+	CreatedAt int64                  `json:"createdAt"`        // 创建时间，UTC时间戳
+	Source    int                    `json:"source,omitempty"` // 回滚产生的版本记录来源版本号
+	Data      authutil.EncryptedData `json:"data"`             // 加密后的值
+}
+
+// secretFile 单个机密在磁盘上的结构，按版本号升序保存
+type secretFile struct {
+	Name     string    `json:"name"`
+	Current  int       `json:"current"`
+	Versions []Version `json:"versions"`
+}
+
+// SecretInfo 机密的元数据，不包含值
+type SecretInfo struct {
+	Name      string `json:"name"`
+	Version   int    `json:"version"`         // 当前版本号
+	Versions  []int  `json:"versions"`        // 保留的全部版本号
+	UpdatedAt int64  `json:"updatedAt"`       // 当前版本的创建时间，UTC时间戳
+	Error     string `json:"error,omitempty"` // 文件无法读取或解析时的错误，其余字段为空
+}
+
+// VersionInfo 机密版本的元数据，不包含值
+type VersionInfo struct {
+	Version   int   `json:"version"`
+	CreatedAt int64 `json:"createdAt"`
+	Source    int   `json:"source,omitempty"`
+	Current   bool  `json:"current"`
+}
+
+// Store 机密存储，每个机密保存为目录下的一个 JSON 文件，值使用认证器的活跃公钥加密
+type Store struct {
+	mu          sync.Mutex
+	dir         string
+	auth        *authutil.Authenticator
+	maxVersions int
+}
+
+// NewStore 创建机密存储，auth 需要持有活跃公钥用于写入，以及对应私钥用于读取
+func NewStore(dir string, auth *authutil.Authenticator) (*Store, error) {
+	if auth == nil {
+		return nil, errors.New("authenticator is nil")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Store{dir: dir, auth: auth, maxVersions: defaultMaxVersions}, nil
+}
+
+// SetMaxVersions 设置每个机密保留的版本数，超出时删除最早的版本
+func (s *Store) SetMaxVersions(n int) {
+	if n <= 0 {
+		n = defaultMaxVersions
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxVersions = n
+}
+
+// Put 写入机密的新版本并设为当前版本
+func (s *Store) Put(name string, value string) (SecretInfo, error) {
+	if !namePattern.MatchString(name) {
+		return SecretInfo{}, ErrInvalidName
+	}
+	data, err := s.auth.EncryptAESString(value)
+	if err != nil {
+		return SecretInfo{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, err := s.readLocked(name)
+	if errors.Is(err, ErrSecretNotFound) {
+		secret, err = &secretFile{Name: name}, nil
+	}
+	if err != nil {
+		return SecretInfo{}, err
+	}
+	if err := s.appendLocked(secret, Version{Data: data}); err != nil {
+		return SecretInfo{}, err
+	}
+	return secret.info(), nil
+}
+
+// Get 读取机密的当前值
+func (s *Store) Get(name string) (string, SecretInfo, error) {
+	return s.GetVersion(name, 0)
+}
+
+// GetVersion 读取机密指定版本的值，version 为 0 表示当前版本
+func (s *Store) GetVersion(name string, version int) (string, SecretInfo, error) {
+	if !namePattern.MatchString(name) {
+		return "", SecretInfo{}, ErrInvalidName
+	}
+
+	s.mu.Lock()
+	secret, err := s.readLocked(name)
+	s.mu.Unlock()
+	if err != nil {
+		return "", SecretInfo{}, err
+	}
+
+	if version == 0 {
+		version = secret.Current
+	}
+	v, ok := secret.find(version)
+	if !ok {
+		return "", secret.info(), ErrVersionNotFound
+	}
+	value, err := s.auth.DecryptAESString(v.Data)
+	if err != nil {
+		return "", secret.info(), fmt.Errorf("decrypt secret %q version %d: %w", name, version, err)
+	}
+	return value, secret.info(), nil
+}
+
+// Delete 删除机密及其全部版本
+func (s *Store) Delete(name string) error {
+	if !namePattern.MatchString(name) {
+		return ErrInvalidName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.Remove(s.file(name)); err != nil {
+		if os.IsNotExist(err) {
+			return ErrSecretNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// List 列出全部机密的元数据，按名称排序；无法读取或解析的文件同样列出，Error 为错误原因
+func (s *Store) List() ([]SecretInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]SecretInfo, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".json")
+		if file.IsDir() || name == file.Name() || !namePattern.MatchString(name) {
+			continue
+		}
+		secret, err := s.readLocked(name)
+		if err != nil {
+			list = append(list, SecretInfo{Name: name, Versions: []int{}, Error: err.Error()})
+			continue
+		}
+		list = append(list, secret.info())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// Versions 列出机密保留的全部版本，按版本号升序
+func (s *Store) Versions(name string) ([]VersionInfo, error) {
+	if !namePattern.MatchString(name) {
+		return nil, ErrInvalidName
+	}
+
+	s.mu.Lock()
+	secret, err := s.readLocked(name)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]VersionInfo, 0, len(secret.Versions))
+	for _, v := range secret.Versions {
+		versions = append(versions, VersionInfo{
+			Version:   v.Version,
+			CreatedAt: v.CreatedAt,
+			Source:    v.Source,
+			Current:   v.Version == secret.Current,
+		})
+	}
+	return versions, nil
+}
+
+// Rollback 以指定版本的值创建新版本并设为当前版本，历史版本保持不变；
+// 值会用当前活跃公钥重新加密，新版本不依赖旧版本所用的密钥
+func (s *Store) Rollback(name string, version int) (SecretInfo, error) {
+	if !namePattern.MatchString(name) {
+		return SecretInfo{}, ErrInvalidName
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	secret, err := s.readLocked(name)
+	if err != nil {
+		return SecretInfo{}, err
+	}
+	v, ok := secret.find(version)
+	if !ok {
+		return secret.info(), ErrVersionNotFound
+	}
+	data, err := s.reencrypt(v.Data)
+	if err != nil {
+		return secret.info(), fmt.Errorf("rewrap secret %q version %d: %w", name, version, err)
+	}
+	if err := s.appendLocked(secret, Version{Source: v.Version, Data: data}); err != nil {
+		return SecretInfo{}, err
+	}
+	return secret.info(), nil
+}
+
+// Rewrap 用当前活跃公钥重新加密全部机密中由其他密钥加密的版本，版本号和创建时间保持不变；
+// 密钥轮换后、移除旧私钥前执行，返回重新加密的版本数。无法解密的版本保持原样，错误合并后返回
+func (s *Store) Rewrap() (int, error) {
+	activeID := ""
+	for _, key := range s.auth.Keys() {
+		if key.State == authutil.KeyStateActive {
+			activeID = key.ID
+		}
+	}
+	if len(activeID) == 0 {
+		return 0, errors.New("no active key")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	var errs []error
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".json")
+		if file.IsDir() || name == file.Name() || !namePattern.MatchString(name) {
+			continue
+		}
+		secret, err := s.readLocked(name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		changed := 0
+		for i, v := range secret.Versions {
+			if v.Data.KeyID == activeID {
+				continue
+			}
+			data, err := s.reencrypt(v.Data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("rewrap secret %q version %d: %w", name, v.Version, err))
+				continue
+			}
+			secret.Versions[i].Data = data
+			changed++
+		}
+		if changed == 0 {
+			continue
+		}
+		if err := s.writeLocked(secret); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		count += changed
+	}
+	return count, errors.Join(errs...)
+}
+
+// reencrypt 解密后用当前活跃公钥重新加密
+func (s *Store) reencrypt(data authutil.EncryptedData) (authutil.EncryptedData, error) {
+	value, err := s.auth.DecryptAESString(data)
+	if err != nil {
+		return authutil.EncryptedData{}, err
+	}
+	return s.auth.EncryptAESString(value)
+}
+
+func (s *Store) file(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+func (s *Store) readLocked(name string) (*secretFile, error) {
+	data, err := os.ReadFile(s.file(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSecretNotFound
+		}
+		return nil, err
+	}
+	var secret secretFile
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return nil, fmt.Errorf("parse secret %q: %w", name, err)
+	}
+	secret.Name = name
+	return &secret, nil
+}
+
+// appendLocked 追加新版本，超出保留数量时删除最早的版本，然后写回磁盘
+func (s *Store) appendLocked(secret *secretFile, v Version) error {
+	last := 0
+	if n := len(secret.Versions); n > 0 {
+		last = secret.Versions[n-1].Version
+	}
+	v.Version = last + 1
+	v.CreatedAt = time.Now().UnixMilli()
+	secret.Versions = append(secret.Versions, v)
+	secret.Current = v.Version
+	if over := len(secret.Versions) - s.maxVersions; over > 0 {
+		secret.Versions = secret.Versions[over:]
+	}
+	return s.writeLocked(secret)
+}
+
+// writeLocked 把机密写回磁盘
+func (s *Store) writeLocked(secret *secretFile) error {
+	data, err := json.Marshal(secret)
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免进程中断时留下半个文件
+	tmpFile := s.file(secret.Name) + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, s.file(secret.Name))
+}
+
+func (f *secretFile) find(version int) (Version, bool) {
+	for _, v := range f.Versions {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return Version{}, false
+}
+
+func (f *secretFile) info() SecretInfo {
+	info := SecretInfo{Name: f.Name, Version: f.Current, Versions: make([]int, 0, len(f.Versions))}
+	for _, v := range f.Versions {
+		info.Versions = append(info.Versions, v.Version)
+		if v.Version == f.Current {
+			info.UpdatedAt = v.CreatedAt
+		}
+	}
+	return info
+}
@@ -0,0 +1,195 @@
+package secretutil_test
+
+import (
+	"errors"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/secretutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func addKey(t *testing.T, auth *authutil.Authenticator) string {
+	t.Helper()
+	private, _, err := authutil.GenerateRSAKeyPair(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := auth.AddKey(private, authutil.KeyStateActive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func newStore(t *testing.T) (*secretutil.Store, *authutil.Authenticator, string) {
+	t.Helper()
+	auth := authutil.NewAuthenticator()
+	addKey(t, auth)
+	dir := t.TempDir()
+	store, err := secretutil.NewStore(dir, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store, auth, dir
+}
+
+func mustGet(t *testing.T, store *secretutil.Store, name string, version int) string {
+	t.Helper()
+	value, _, err := store.GetVersion(name, version)
+	if err != nil {
+		t.Fatalf("GetVersion(%q, %d): %v", name, version, err)
+	}
+	return value
+}
+
+func TestPutGetVersions(t *testing.T) {
+	store, _, dir := newStore(t)
+	store.SetMaxVersions(2)
+	for _, value := range []string{"v-1", "v-2", "v-3"} {
+		if _, err := store.Put("db-password", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	value, info, err := store.Get("db-password")
+	if err != nil || value != "v-3" || info.Version != 3 {
+		t.Fatalf("Get = %q, %+v, %v", value, info, err)
+	}
+	if !reflect.DeepEqual(info.Versions, []int{2, 3}) {
+		t.Errorf("versions = %v, want [2 3]", info.Versions)
+	}
+	if got := mustGet(t, store, "db-password", 2); got != "v-2" {
+		t.Errorf("version 2 = %q", got)
+	}
+	if _, _, err := store.GetVersion("db-password", 1); !errors.Is(err, secretutil.ErrVersionNotFound) {
+		t.Errorf("pruned version: err = %v", err)
+	}
+
+	// 磁盘上只保存密文
+	data, err := os.ReadFile(filepath.Join(dir, "db-password.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "v-3") {
+		t.Errorf("plaintext on disk: %s", data)
+	}
+
+	if err := store.Delete("db-password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.Get("db-password"); !errors.Is(err, secretutil.ErrSecretNotFound) {
+		t.Errorf("after Delete: err = %v", err)
+	}
+	if _, err := store.Put("../escape", "x"); !errors.Is(err, secretutil.ErrInvalidName) {
+		t.Errorf("invalid name: err = %v", err)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	store, auth, _ := newStore(t)
+	oldID := auth.Keys()[0].ID
+	for _, value := range []string{"v1", "v2"} {
+		if _, err := store.Put("token", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 轮换密钥后回滚，新版本用新密钥重新加密，移除旧私钥后仍可读取
+	addKey(t, auth)
+	info, err := store.Rollback("token", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != 3 || !reflect.DeepEqual(info.Versions, []int{1, 2, 3}) {
+		t.Errorf("info = %+v", info)
+	}
+	versions, err := store.Versions("token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := versions[len(versions)-1]; last.Source != 1 || !last.Current {
+		t.Errorf("rollback version = %+v", last)
+	}
+
+	if err := auth.RemoveKey(oldID); err != nil {
+		t.Fatal(err)
+	}
+	if got := mustGet(t, store, "token", 0); got != "v1" {
+		t.Errorf("current = %q, want v1", got)
+	}
+	if _, _, err := store.GetVersion("token", 2); err == nil {
+		t.Error("version 2 still readable without its key")
+	}
+	if _, err := store.Rollback("token", 9); !errors.Is(err, secretutil.ErrVersionNotFound) {
+		t.Errorf("missing version: err = %v", err)
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	store, auth, dir := newStore(t)
+	oldID := auth.Keys()[0].ID
+	for _, name := range []string{"a", "b"} {
+		for _, value := range []string{name + "1", name + "2"} {
+			if _, err := store.Put(name, value); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	addKey(t, auth)
+	count, err := store.Rewrap()
+	if count != 4 {
+		t.Errorf("count = %d, want 4", count)
+	}
+	if err == nil {
+		t.Error("corrupt file not reported")
+	}
+	// 已重新加密的版本不再重复处理
+	if count, _ := store.Rewrap(); count != 0 {
+		t.Errorf("second Rewrap count = %d, want 0", count)
+	}
+
+	if err := auth.RemoveKey(oldID); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if got := mustGet(t, store, name, 1); got != name+"1" {
+			t.Errorf("%s version 1 = %q", name, got)
+		}
+		if got := mustGet(t, store, name, 0); got != name+"2" {
+			t.Errorf("%s current = %q", name, got)
+		}
+	}
+}
+
+func TestListCorruptFile(t *testing.T) {
+	store, _, dir := newStore(t)
+	if _, err := store.Put("good", "value"); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string]string{"broken.json": "not json", "notes.txt": "ignored"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Name != "broken" || list[1].Name != "good" {
+		t.Fatalf("list = %+v", list)
+	}
+	if len(list[0].Error) == 0 || list[0].Versions == nil {
+		t.Errorf("broken entry = %+v", list[0])
+	}
+	if len(list[1].Error) > 0 || list[1].Version != 1 {
+		t.Errorf("good entry = %+v", list[1])
+	}
+}
@@ -0,0 +1,230 @@
+package transferutil
+
+import (
+	"errors"
+	"github.com/atmshang/nuclear-nest/pkg/apiutil"
+	"github.com/atmshang/nuclear-nest/pkg/authutil"
+	"github.com/atmshang/nuclear-nest/pkg/datautil"
+	"github.com/gin-gonic/gin"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const headerUploadOffset = "Upload-Offset"
+
+var (
+	defaultManager *Manager
+	defaultErr     error
+	defaultOnce    sync.Once
+	maxFileSize    = defaultMaxFileSize
+	quota          = defaultQuota
+	uploadTTL      = defaultUploadTTL
+)
+
+// SetQuota 设置默认管理器的单文件上限和总配额，需在首次使用前调用
+func SetQuota(fileSizeLimit int64, totalQuota int64) {
+	maxFileSize = fileSizeLimit
+	quota = totalQuota
+}
+
+// SetUploadTTL 设置默认管理器中未完成上传的保留时长，需在首次使用前调用
+func SetUploadTTL(ttl time.Duration) {
+	uploadTTL = ttl
+}
+
+// Default 获取默认管理器，文件保存在数据目录的 transfers 文件夹中；首次创建失败时之后每次都返回同一个错误
+func Default() (*Manager, error) {
+	defaultOnce.Do(func() {
+		dir := filepath.Join(datautil.GetRelDataPath(), "transfers")
+		defaultManager, defaultErr = NewManager(dir, maxFileSize, quota, uploadTTL)
+	})
+	return defaultManager, defaultErr
+}
+
+// UploadStatus 上传状态，返回给客户端用于展示进度和续传
+type UploadStatus struct {
+	Upload
+	Progress float64 `json:"progress"`
+}
+
+type createUploadRequest struct {
+	FileName string `json:"fileName" binding:"required"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256" binding:"required"`
+}
+
+// RegisterRoutes 在路由组上注册断点续传接口，全部接口都需要通过 InternalServiceAuth 认证
+func RegisterRoutes(group *gin.RouterGroup) {
+	g := group.Group("", authutil.InternalServiceAuth())
+	g.POST("/uploads", CreateUploadFunc)
+	g.GET("/uploads/:id", GetUploadFunc)
+	g.HEAD("/uploads/:id", GetUploadFunc)
+	g.PATCH("/uploads/:id", UploadChunkFunc)
+	g.DELETE("/uploads/:id", AbortUploadFunc)
+	g.GET("/files/:id", DownloadFunc)
+	g.HEAD("/files/:id", DownloadFunc)
+	g.DELETE("/files/:id", DeleteFileFunc)
+}
+
+// CreateUploadFunc 创建上传会话，请求体包含文件名、大小和 SHA-256
+func CreateUploadFunc(c *gin.Context) {
+	var req createUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, apiutil.Response{
+			Code:    4000,
+			Message: err.Error(),
+			Data:    apiutil.EmptyResponse{},
+		})
+		return
+	}
+
+	m, err := Default()
+	if err != nil {
+		abortWithTransferError(c, Upload{}, err)
+		return
+	}
+	upload, err := m.Create(req.FileName, req.Size, req.SHA256)
+	if err != nil {
+		abortWithTransferError(c, upload, err)
+		return
+	}
+	respondUpload(c, http.StatusCreated, upload)
+}
+
+// GetUploadFunc 查询上传进度，Upload-Offset 头部为续传的起始位置
+func GetUploadFunc(c *gin.Context) {
+	m, err := Default()
+	if err != nil {
+		abortWithTransferError(c, Upload{}, err)
+		return
+	}
+	upload, err := m.Get(c.Param("id"))
+	if err != nil {
+		abortWithTransferError(c, upload, err)
+		return
+	}
+	respondUpload(c, http.StatusOK, upload)
+}
+
+// UploadChunkFunc 上传分片，偏移量来自 Upload-Offset 头部或 offset 查询参数
+func UploadChunkFunc(c *gin.Context) {
+	offsetStr := c.GetHeader(headerUploadOffset)
+	if len(offsetStr) == 0 {
+		offsetStr = c.Query("offset")
+	}
+	offset, err := strconv.ParseInt(offsetStr, 10, 64)
+	if err != nil || offset < 0 {
+		c.AbortWithStatusJSON(http.StatusBadRequest, apiutil.Response{
+			Code:    4000,
+			Message: "Invalid upload offset",
+			Data:    apiutil.EmptyResponse{},
+		})
+		return
+	}
+
+	m, err := Default()
+	if err != nil {
+		abortWithTransferError(c, Upload{}, err)
+		return
+	}
+	upload, err := m.WriteChunk(c.Param("id"), offset, c.Request.Body)
+	if err != nil {
+		abortWithTransferError(c, upload, err)
+		return
+	}
+	respondUpload(c, http.StatusOK, upload)
+}
+
+func AbortUploadFunc(c *gin.Context) {
+	m, err := Default()
+	if err != nil {
+		abortWithTransferError(c, Upload{}, err)
+		return
+	}
+	if err := m.Abort(c.Param("id")); err != nil {
+		abortWithTransferError(c, Upload{}, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    apiutil.EmptyResponse{},
+	})
+}
+
+func DeleteFileFunc(c *gin.Context) {
+	m, err := Default()
+	if err != nil {
+		abortWithTransferError(c, Upload{}, err)
+		return
+	}
+	if err := m.Delete(c.Param("id")); err != nil {
+		abortWithTransferError(c, Upload{}, err)
+		return
+	}
+	c.JSON(http.StatusOK, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    apiutil.EmptyResponse{},
+	})
+}
+
+// DownloadFunc 下载已完成的文件，支持 HTTP Range 断点续传
+func DownloadFunc(c *gin.Context) {
+	m, err := Default()
+	if err != nil {
+		abortWithTransferError(c, Upload{}, err)
+		return
+	}
+	file, upload, err := m.Open(c.Param("id"))
+	if err != nil {
+		abortWithTransferError(c, upload, err)
+		return
+	}
+	defer file.Close()
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": upload.FileName}))
+	c.Header("ETag", `"`+upload.SHA256+`"`)
+	http.ServeContent(c.Writer, c.Request, upload.FileName, time.UnixMilli(upload.UpdatedAt), file)
+}
+
+func respondUpload(c *gin.Context, status int, upload Upload) {
+	c.Header(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+	c.JSON(status, apiutil.Response{
+		Code:    2000,
+		Message: "",
+		Data:    UploadStatus{Upload: upload, Progress: upload.Progress()},
+	})
+}
+
+func abortWithTransferError(c *gin.Context, upload Upload, err error) {
+	status, code := http.StatusInternalServerError, 5000
+	switch {
+	case errors.Is(err, ErrUploadNotFound), errors.Is(err, ErrFileNotFound):
+		status, code = http.StatusNotFound, 4040
+	case errors.Is(err, ErrOffsetMismatch), errors.Is(err, ErrUploadCompleted), errors.Is(err, ErrUploadBusy):
+		status, code = http.StatusConflict, 4090
+	case errors.Is(err, ErrFileTooLarge), errors.Is(err, ErrChunkTooLarge), errors.Is(err, ErrQuotaExceeded):
+		status, code = http.StatusRequestEntityTooLarge, 4130
+	case errors.Is(err, ErrChecksumMismatch):
+		status, code = http.StatusUnprocessableEntity, 4220
+	case errors.Is(err, ErrInvalidFileName), errors.Is(err, ErrInvalidChecksum):
+		status, code = http.StatusBadRequest, 4000
+	}
+
+	// 客户端可根据返回的 offset 调整续传位置
+	var data interface{} = apiutil.EmptyResponse{}
+	if upload.ID != "" {
+		c.Header(headerUploadOffset, strconv.FormatInt(upload.Offset, 10))
+		data = UploadStatus{Upload: upload, Progress: upload.Progress()}
+	}
+	c.AbortWithStatusJSON(status, apiutil.Response{
+		Code:    code,
+		Message: err.Error(),
+		Data:    data,
+	})
+}
@@ -0,0 +1,447 @@
+package transferutil
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxFileSize = int64(2) << 30 // 单个文件默认上限 2GB
+	defaultQuota       = int64(8) << 30 // 全部文件默认配额 8GB
+	defaultUploadTTL   = 24 * time.Hour // 未完成的上传默认在一天无进展后过期
+	cleanupInterval    = time.Minute    // 过期上传的清理间隔
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrFileNotFound     = errors.New("file not found")
+	ErrFileTooLarge     = errors.New("file exceeds size limit")
+	ErrQuotaExceeded    = errors.New("storage quota exceeded")
+	ErrOffsetMismatch   = errors.New("upload offset mismatch")
+	ErrChunkTooLarge    = errors.New("chunk exceeds declared file size")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrUploadCompleted  = errors.New("upload already completed")
+	ErrUploadBusy       = errors.New("upload is receiving another chunk")
+	ErrInvalidFileName  = errors.New("invalid file name")
+	ErrInvalidChecksum  = errors.New("invalid sha256 checksum")
+)
+
+// Upload 上传会话，元数据以 JSON 形式保存在数据目录中
+type Upload struct {
+	ID        string `json:"id"`
+	FileName  string `json:"fileName"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Offset    int64  `json:"offset"` // 已接收的字节数
+	Completed bool   `json:"completed"`
+	CreatedAt int64  `json:"createdAt"` // 创建时间，UTC时间戳
+	UpdatedAt int64  `json:"updatedAt"` // 更新时间，UTC时间戳
+}
+
+// Progress 上传进度，0~100
+func (u Upload) Progress() float64 {
+	if u.Size == 0 {
+		return 100
+	}
+	return float64(u.Offset) * 100 / float64(u.Size)
+}
+
+// Manager 断点续传管理器，未完成的分片保存在 uploads 目录，完成的文件保存在 files 目录
+type Manager struct {
+	mu          sync.Mutex
+	dir         string
+	maxFileSize int64
+	quota       int64
+	ttl         time.Duration
+	uploads     map[string]*Upload
+	writing     map[string]bool
+}
+
+// NewManager 创建断点续传管理器，maxFileSize 为单个文件上限，quota 为全部文件的总配额，
+// ttl 为未完成上传的保留时长，超过 ttl 没有新分片的上传会被删除并释放预留的配额
+func NewManager(dir string, maxFileSize int64, quota int64, ttl time.Duration) (*Manager, error) {
+	if maxFileSize <= 0 {
+		maxFileSize = defaultMaxFileSize
+	}
+	if quota <= 0 {
+		quota = defaultQuota
+	}
+	if ttl <= 0 {
+		ttl = defaultUploadTTL
+	}
+	for _, sub := range []string{"uploads", "files"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), os.ModePerm); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &Manager{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		quota:       quota,
+		ttl:         ttl,
+		uploads:     make(map[string]*Upload),
+		writing:     make(map[string]bool),
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	go func() {
+		// 定期清理过期的上传，客户端断开后遗留的会话不会一直占用配额
+		ticker := time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			m.Cleanup()
+		}
+	}()
+
+	return m, nil
+}
+
+// Create 创建上传会话，checksum 为整个文件的 SHA-256 十六进制摘要
+func (m *Manager) Create(fileName string, size int64, checksum string) (Upload, error) {
+	fileName = filepath.Base(filepath.Clean(fileName))
+	if fileName == "." || fileName == ".." || fileName == string(filepath.Separator) || fileName == "" {
+		return Upload{}, ErrInvalidFileName
+	}
+	checksum = strings.ToLower(checksum)
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		return Upload{}, ErrInvalidChecksum
+	}
+	if size < 0 || size > m.maxFileSize {
+		return Upload{}, ErrFileTooLarge
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 先释放已过期的预留，避免配额要等到下一次定期清理才能回收
+	m.expireLocked()
+	if m.usedLocked()+size > m.quota {
+		return Upload{}, ErrQuotaExceeded
+	}
+
+	id, err := newID()
+	if err != nil {
+		return Upload{}, err
+	}
+	now := time.Now().UnixMilli()
+	upload := &Upload{
+		ID:        id,
+		FileName:  fileName,
+		Size:      size,
+		SHA256:    checksum,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	file, err := os.Create(m.partFile(id))
+	if err != nil {
+		return Upload{}, err
+	}
+	_ = file.Close()
+
+	if err := m.persistLocked(upload); err != nil {
+		_ = os.Remove(m.partFile(id))
+		return Upload{}, err
+	}
+	m.uploads[id] = upload
+
+	// 零字节文件无需分片，直接校验完成
+	if size == 0 {
+		if err := m.completeLocked(upload, hex.EncodeToString(sha256.New().Sum(nil))); err != nil {
+			return *upload, err
+		}
+	}
+	return *upload, nil
+}
+
+// Get 获取上传会话
+func (m *Manager) Get(id string) (Upload, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[id]
+	if !ok {
+		return Upload{}, ErrUploadNotFound
+	}
+	return *upload, nil
+}
+
+// WriteChunk 在 offset 处写入分片，offset 必须等于已接收的字节数；
+// 收到最后一个分片后会校验 SHA-256 并转存为完成文件
+func (m *Manager) WriteChunk(id string, offset int64, r io.Reader) (Upload, error) {
+	m.mu.Lock()
+	upload, ok := m.uploads[id]
+	if !ok {
+		m.mu.Unlock()
+		return Upload{}, ErrUploadNotFound
+	}
+	if upload.Completed {
+		m.mu.Unlock()
+		return *upload, ErrUploadCompleted
+	}
+	if m.writing[id] {
+		m.mu.Unlock()
+		return *upload, ErrUploadBusy
+	}
+	if offset != upload.Offset {
+		m.mu.Unlock()
+		return *upload, ErrOffsetMismatch
+	}
+	m.writing[id] = true
+	remaining := upload.Size - upload.Offset
+	m.mu.Unlock()
+
+	// 写分片时不持有全局锁，同一会话的并发写入由 writing 标记拒绝
+	written, err := m.writePart(id, offset, remaining, r)
+
+	m.mu.Lock()
+	// 即使读取中断，已落盘的部分也计入进度，客户端可从新的 offset 续传
+	if !errors.Is(err, ErrChunkTooLarge) {
+		upload.Offset += written
+		upload.UpdatedAt = time.Now().UnixMilli()
+		if persistErr := m.persistLocked(upload); persistErr != nil && err == nil {
+			err = persistErr
+		}
+	}
+	if err != nil || upload.Offset != upload.Size {
+		delete(m.writing, id)
+		snapshot := *upload
+		m.mu.Unlock()
+		return snapshot, err
+	}
+	m.mu.Unlock()
+
+	// 校验整个文件耗时较长，期间不持有全局锁，writing 标记继续拒绝同一会话的写入和终止
+	sum, err := m.hashPart(id)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.writing, id)
+	if err != nil {
+		return *upload, err
+	}
+	if err := m.completeLocked(upload, sum); err != nil {
+		return *upload, err
+	}
+	return *upload, nil
+}
+
+func (m *Manager) writePart(id string, offset int64, remaining int64, r io.Reader) (int64, error) {
+	file, err := os.OpenFile(m.partFile(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	// 多读一个字节用于判断分片是否超出声明的文件大小
+	written, err := io.Copy(file, io.LimitReader(r, remaining+1))
+	if written > remaining {
+		_ = file.Truncate(offset)
+		return 0, ErrChunkTooLarge
+	}
+	return written, err
+}
+
+// Abort 终止上传并删除分片
+func (m *Manager) Abort(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[id]
+	if !ok {
+		return ErrUploadNotFound
+	}
+	if upload.Completed {
+		return ErrUploadCompleted
+	}
+	if m.writing[id] {
+		return ErrUploadBusy
+	}
+	delete(m.uploads, id)
+	_ = os.Remove(m.partFile(id))
+	return os.Remove(m.metaFile(id))
+}
+
+// Delete 删除已完成的文件
+func (m *Manager) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	upload, ok := m.uploads[id]
+	if !ok || !upload.Completed {
+		return ErrFileNotFound
+	}
+	delete(m.uploads, id)
+	_ = os.Remove(m.completedFile(id))
+	return os.Remove(m.metaFile(id))
+}
+
+// Open 打开已完成的文件用于下载，调用方负责关闭
+func (m *Manager) Open(id string) (*os.File, Upload, error) {
+	m.mu.Lock()
+	upload, ok := m.uploads[id]
+	if !ok || !upload.Completed {
+		m.mu.Unlock()
+		return nil, Upload{}, ErrFileNotFound
+	}
+	snapshot := *upload
+	m.mu.Unlock()
+
+	file, err := os.Open(m.completedFile(id))
+	if err != nil {
+		return nil, snapshot, err
+	}
+	return file, snapshot, nil
+}
+
+// hashPart 计算分片文件的 SHA-256，调用时不持有全局锁
+func (m *Manager) hashPart(id string) (string, error) {
+	file, err := os.Open(m.partFile(id))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// completeLocked 比对分片的 SHA-256，通过后转存为完成文件；校验失败时清空分片以便重新上传
+func (m *Manager) completeLocked(upload *Upload, sum string) error {
+	if sum != upload.SHA256 {
+		upload.Offset = 0
+		upload.UpdatedAt = time.Now().UnixMilli()
+		_ = os.Truncate(m.partFile(upload.ID), 0)
+		_ = m.persistLocked(upload)
+		return ErrChecksumMismatch
+	}
+
+	if err := os.Rename(m.partFile(upload.ID), m.completedFile(upload.ID)); err != nil {
+		return err
+	}
+	upload.Completed = true
+	upload.UpdatedAt = time.Now().UnixMilli()
+	return m.persistLocked(upload)
+}
+
+// Cleanup 删除超过保留时长仍未完成的上传及其分片，释放预留的配额
+func (m *Manager) Cleanup() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expireLocked()
+}
+
+// expireLocked 删除过期的未完成上传，正在写入分片的会话不会被删除
+func (m *Manager) expireLocked() {
+	deadline := time.Now().Add(-m.ttl).UnixMilli()
+	for id, upload := range m.uploads {
+		if upload.Completed || m.writing[id] || upload.UpdatedAt >= deadline {
+			continue
+		}
+		delete(m.uploads, id)
+		_ = os.Remove(m.partFile(id))
+		_ = os.Remove(m.metaFile(id))
+	}
+}
+
+// usedLocked 已占用的配额，未完成的上传按声明大小预留
+func (m *Manager) usedLocked() int64 {
+	var used int64
+	for _, upload := range m.uploads {
+		used += upload.Size
+	}
+	return used
+}
+
+/*****************************************************************
+*							持久化
+*****************************************************************/
+
+func (m *Manager) metaFile(id string) string {
+	return filepath.Join(m.dir, "uploads", id+".json")
+}
+
+func (m *Manager) partFile(id string) string {
+	return filepath.Join(m.dir, "uploads", id+".part")
+}
+
+func (m *Manager) completedFile(id string) string {
+	return filepath.Join(m.dir, "files", id)
+}
+
+func (m *Manager) persistLocked(upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再重命名，避免进程中断时留下半个文件
+	tmpFile := m.metaFile(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, m.metaFile(upload.ID))
+}
+
+// load 从数据目录恢复上传会话，进度以分片文件的实际大小为准
+func (m *Manager) load() error {
+	files, err := os.ReadDir(filepath.Join(m.dir, "uploads"))
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(m.dir, "uploads", file.Name()))
+		if err != nil {
+			continue
+		}
+		var upload Upload
+		if err := json.Unmarshal(data, &upload); err != nil || upload.ID == "" {
+			continue
+		}
+
+		if !upload.Completed {
+			info, err := os.Stat(m.partFile(upload.ID))
+			if err != nil {
+				continue
+			}
+			if info.Size() != upload.Offset && info.Size() <= upload.Size {
+				upload.Offset = info.Size()
+			}
+		}
+		m.uploads[upload.ID] = &upload
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
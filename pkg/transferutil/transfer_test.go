@@ -0,0 +1,158 @@
+package transferutil
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func newTestManager(t *testing.T, maxFileSize int64, quota int64, ttl time.Duration) *Manager {
+	t.Helper()
+	m, err := NewManager(t.TempDir(), maxFileSize, quota, ttl)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	return m
+}
+
+func TestUploadResumeAndComplete(t *testing.T) {
+	m := newTestManager(t, 1024, 4096, time.Hour)
+	data := []byte("firmware image contents")
+
+	upload, err := m.Create("fw.bin", int64(len(data)), checksumOf(data))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if upload, err = m.WriteChunk(upload.ID, 0, bytes.NewReader(data[:10])); err != nil || upload.Offset != 10 {
+		t.Fatalf("first chunk: offset = %d, err = %v", upload.Offset, err)
+	}
+	if _, err := m.WriteChunk(upload.ID, 0, bytes.NewReader(data[10:])); !errors.Is(err, ErrOffsetMismatch) {
+		t.Fatalf("stale offset: err = %v, want ErrOffsetMismatch", err)
+	}
+
+	// 重启后进度从分片文件恢复
+	restarted, err := NewManager(m.dir, 1024, 4096, time.Hour)
+	if err != nil {
+		t.Fatalf("NewManager: %v", err)
+	}
+	if upload, err = restarted.WriteChunk(upload.ID, 10, bytes.NewReader(data[10:])); err != nil || !upload.Completed {
+		t.Fatalf("last chunk: upload = %+v, err = %v", upload, err)
+	}
+
+	file, _, err := restarted.Open(upload.ID)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer file.Close()
+	got, _ := io.ReadAll(file)
+	if !bytes.Equal(got, data) {
+		t.Errorf("downloaded %q, want %q", got, data)
+	}
+}
+
+func TestUploadChecksumMismatchResets(t *testing.T) {
+	m := newTestManager(t, 1024, 4096, time.Hour)
+	upload, err := m.Create("fw.bin", 4, checksumOf([]byte("good")))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	upload, err = m.WriteChunk(upload.ID, 0, bytes.NewReader([]byte("evil")))
+	if !errors.Is(err, ErrChecksumMismatch) || upload.Offset != 0 || upload.Completed {
+		t.Fatalf("upload = %+v, err = %v", upload, err)
+	}
+	if _, err := m.WriteChunk(upload.ID, 0, bytes.NewReader([]byte("good"))); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	m := newTestManager(t, 8, 12, time.Hour)
+	data := []byte("12345678")
+
+	if _, err := m.Create("big.bin", 9, checksumOf(nil)); !errors.Is(err, ErrFileTooLarge) {
+		t.Errorf("oversized file: err = %v, want ErrFileTooLarge", err)
+	}
+	upload, err := m.Create("a.bin", 8, checksumOf(data))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// 未完成的上传按声明大小预留配额
+	if _, err := m.Create("b.bin", 8, checksumOf(data)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("over quota: err = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := m.WriteChunk(upload.ID, 0, bytes.NewReader(append(data, '9'))); !errors.Is(err, ErrChunkTooLarge) {
+		t.Errorf("oversized chunk: err = %v, want ErrChunkTooLarge", err)
+	}
+	if err := m.Abort(upload.ID); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if _, err := m.Create("b.bin", 8, checksumOf(data)); err != nil {
+		t.Errorf("after abort: %v", err)
+	}
+}
+
+func TestExpiredUploadReleasesQuota(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	m := newTestManager(t, 8, 8, ttl)
+	data := []byte("12345678")
+
+	abandoned, err := m.Create("a.bin", 8, checksumOf(data))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := m.WriteChunk(abandoned.ID, 0, bytes.NewReader(data[:4])); err != nil {
+		t.Fatalf("WriteChunk: %v", err)
+	}
+	if _, err := m.Create("b.bin", 8, checksumOf(data)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("before expiry: err = %v, want ErrQuotaExceeded", err)
+	}
+
+	time.Sleep(2 * ttl)
+	m.Cleanup()
+	if _, err := m.Get(abandoned.ID); !errors.Is(err, ErrUploadNotFound) {
+		t.Errorf("expired upload: err = %v, want ErrUploadNotFound", err)
+	}
+	for _, name := range []string{m.partFile(abandoned.ID), m.metaFile(abandoned.ID)} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s still exists: %v", name, err)
+		}
+	}
+	if _, err := m.Create("b.bin", 8, checksumOf(data)); err != nil {
+		t.Errorf("after expiry: %v", err)
+	}
+}
+
+func TestCompletedUploadsDoNotExpire(t *testing.T) {
+	const ttl = 50 * time.Millisecond
+	m := newTestManager(t, 8, 8, ttl)
+	data := []byte("12345678")
+
+	upload, err := m.Create("a.bin", 8, checksumOf(data))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := m.WriteChunk(upload.ID, 0, bytes.NewReader(data)); err != nil {
+		t.Fatalf("WriteChunk: %v", err)
+	}
+
+	time.Sleep(2 * ttl)
+	m.Cleanup()
+	file, _, err := m.Open(upload.ID)
+	if err != nil {
+		t.Fatalf("completed file removed: %v", err)
+	}
+	_ = file.Close()
+	if _, err := m.Create("b.bin", 8, checksumOf(data)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("completed file released quota: err = %v", err)
+	}
+}